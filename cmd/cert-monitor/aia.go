@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	aiaTimeout = 10 * time.Second
+	// aiaMaxDepth bounds how many issuers are followed above the served
+	// certs, which is more than any public hierarchy needs.
+	aiaMaxDepth = 4
+	aiaMaxSize  = 1 << 20
+)
+
+// aiaCache holds the issuers fetched by URL, since many domains share the
+// same intermediates.
+var aiaCache sync.Map
+
+// fetchIssuers follows the CA Issuers URLs of the Authority Information
+// Access extension upwards from cert, returning every issuer it could fetch
+// until a self-signed cert or a cert without the extension is reached.
+func fetchIssuers(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	issuers := []*x509.Certificate{}
+	for i := 0; i < aiaMaxDepth && len(cert.IssuingCertificateURL) > 0; i++ {
+		if cert.CheckSignatureFrom(cert) == nil {
+			break
+		}
+		var issuer *x509.Certificate
+		var err error
+		for _, url := range cert.IssuingCertificateURL {
+			issuer, err = fetchIssuer(ctx, url)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return issuers, err
+		}
+		issuers = append(issuers, issuer)
+		cert = issuer
+	}
+	return issuers, nil
+}
+
+// fetchIssuer downloads one DER or PEM encoded issuer cert.
+func fetchIssuer(ctx context.Context, url string) (*x509.Certificate, error) {
+	if cached, ok := aiaCache.Load(url); ok {
+		return cached.(*x509.Certificate), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, aiaTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, aiaMaxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		certs, pemErr := parsePEM(data, url)
+		if pemErr != nil {
+			return nil, fmt.Errorf("%s did not return a DER or PEM certificate", url)
+		}
+		cert = certs[0]
+	}
+	aiaCache.Store(url, cert)
+	return cert, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// checkAllIPs dials every address the host resolves to, keeping the host as
+// the SNI, and returns the fingerprint of the leaf each address served.
+// Addresses that could not be checked are returned as problems.
+func checkAllIPs(ctx context.Context, host string, port string, tlsConfig *tls.Config, negotiate negotiator) (map[string]string, []string, error) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fingerprints := map[string]string{}
+	problems := []string{}
+	for _, addr := range addrs {
+		conn, _, err := dialDomain(ctx, addr, port, tlsConfig, negotiate)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("address %s could not be checked: %s", addr, err.Error()))
+			continue
+		}
+		fingerprints[addr] = fingerprint(conn.ConnectionState().PeerCertificates[0])
+		conn.Close()
+	}
+	return fingerprints, problems, nil
+}
+
+// ipDiscrepancy describes which addresses served which cert, or returns an
+// empty string when every address served the same one.
+func ipDiscrepancy(fingerprints map[string]string) string {
+	byFingerprint := map[string][]string{}
+	for addr, fp := range fingerprints {
+		byFingerprint[fp] = append(byFingerprint[fp], addr)
+	}
+	if len(byFingerprint) < 2 {
+		return ""
+	}
+
+	groups := []string{}
+	for fp, addrs := range byFingerprint {
+		sort.Strings(addrs)
+		groups = append(groups, fmt.Sprintf("%s (%s)", strings.Join(addrs, ", "), fp[:16]))
+	}
+	sort.Strings(groups)
+	return fmt.Sprintf("addresses serve different certs: %s", strings.Join(groups, "; "))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// stdinPath is the cert file path that reads from stdin.
+const stdinPath = "-"
+
+// loadCertFile reads the certs from a local file, leaf first. Files with a
+// .p12 or .pfx extension are decoded as PKCS#12 bundles, or as trust stores
+// of certs without a private key, anything else is read as PEM. A path of
+// "-" reads PEM from stdin.
+func loadCertFile(path string, password string) ([]*x509.Certificate, error) {
+	var data []byte
+	var err error
+	if path == stdinPath {
+		path = "stdin"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		_, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, fmt.Errorf("failed to decode %s: incorrect password", path)
+		}
+		if err != nil {
+			// Trust stores exported for monitoring hold no key
+			if certs, trustErr := pkcs12.DecodeTrustStore(data, password); trustErr == nil && len(certs) > 0 {
+				return certs, nil
+			}
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		return append([]*x509.Certificate{cert}, caCerts...), nil
+	}
+
+	return parsePEM(data, path)
+}
+
+// parsePEM returns every certificate in PEM data, in order, skipping other
+// blocks such as keys. name identifies the source in errors.
+func parsePEM(data []byte, name string) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", name)
+	}
+	return certs, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ChainCert is one cert of the served chain. Position is leaf for the first
+// cert and intermediate-0, intermediate-1 and so on for the rest.
+type ChainCert struct {
+	Position string
+	Subject  string
+	NotAfter time.Time
+}
+
+// chainCerts describes the served certs in the order they were sent.
+func chainCerts(certs []*x509.Certificate) []ChainCert {
+	chain := []ChainCert{}
+	for i, cert := range certs {
+		position := "leaf"
+		if i > 0 {
+			position = fmt.Sprintf("intermediate-%d", i-1)
+		}
+		chain = append(chain, ChainCert{Position: position, Subject: cert.Subject.String(), NotAfter: cert.NotAfter})
+	}
+	return chain
+}
+
+var (
+	intermediatesOnce sync.Once
+	intermediates     []*x509.Certificate
+	intermediatesErr  error
+)
+
+// loadIntermediates reads the known intermediates bundle once per process.
+func loadIntermediates(path string) ([]*x509.Certificate, error) {
+	intermediatesOnce.Do(func() {
+		intermediates, intermediatesErr = loadCertFile(path, "")
+	})
+	return intermediates, intermediatesErr
+}
+
+// incompleteChain reports whether the served certs are missing the
+// intermediates needed to build a path to the system roots. When a bundle
+// of known intermediates is given, the chain is incomplete if it only
+// verifies with the bundle's help. Without one, it is incomplete if the
+// issuer is unknown and the last served cert is not itself a root. Chains
+// that fail verification for other reasons are left to verify.
+func incompleteChain(certs []*x509.Certificate, bundle []*x509.Certificate) bool {
+	served := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		served.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Intermediates: served})
+	var unknown x509.UnknownAuthorityError
+	if err == nil || !errors.As(err, &unknown) {
+		return false
+	}
+
+	if len(bundle) > 0 {
+		for _, cert := range bundle {
+			served.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Intermediates: served})
+		return err == nil
+	}
+
+	last := certs[len(certs)-1]
+	return last.CheckSignatureFrom(last) != nil
+}
+
+// checkChain records whether the served chain is complete, returning a
+// problem description when it is not.
+func checkChain(d *Domain, certs []*x509.Certificate, bundlePath string) string {
+	var bundle []*x509.Certificate
+	if bundlePath != "" {
+		var err error
+		bundle, err = loadIntermediates(bundlePath)
+		if err != nil {
+			return fmt.Sprintf("failed to load intermediates bundle: %s", err.Error())
+		}
+	}
+	d.IncompleteChain = incompleteChain(certs, bundle)
+	if d.IncompleteChain {
+		return "server did not send the intermediates needed to build a chain"
+	}
+	return ""
+}
+
+// misorderedAt returns the index of the first served cert that is not signed
+// by the cert sent after it, as TLS requires, or -1 when the chain is in
+// order. A root at the end may be sent or left out.
+func misorderedAt(certs []*x509.Certificate) int {
+	for i := 0; i < len(certs)-1; i++ {
+		if certs[i].CheckSignatureFrom(certs[i+1]) != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkChainOrder records whether the served chain is out of order,
+// returning a problem description when it is.
+func checkChainOrder(d *Domain, certs []*x509.Certificate) string {
+	i := misorderedAt(certs)
+	if i < 0 {
+		return ""
+	}
+	d.MisorderedChain = true
+	chain := chainCerts(certs)
+	return fmt.Sprintf("served chain is out of order, %s (%s) is not signed by %s (%s) sent after it",
+		chain[i].Position, chain[i].Subject, chain[i+1].Position, chain[i+1].Subject)
+}
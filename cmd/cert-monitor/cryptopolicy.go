@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CryptoPolicy lists the public key algorithms certs may use and the least
+// size of each. Keys of any algorithm not listed are flagged.
+type CryptoPolicy struct {
+	Allow []AllowedKey `yaml:"allow,omitempty"`
+}
+
+// AllowedKey allows keys of an algorithm (rsa, ecdsa or ed25519) of at
+// least MinBits, the modulus size for rsa and the curve size for ecdsa.
+type AllowedKey struct {
+	Algorithm string `yaml:"algorithm"`
+	MinBits   int    `yaml:"min_bits,omitempty"`
+}
+
+// keyAlgorithms are the algorithm names a policy can allow.
+var keyAlgorithms = []string{"rsa", "ecdsa", "ed25519"}
+
+func (p CryptoPolicy) enabled() bool {
+	return len(p.Allow) > 0
+}
+
+// loadCryptoPolicy reads a policy file, which holds the same settings as
+// crypto_policy.
+func loadCryptoPolicy(path string) (CryptoPolicy, error) {
+	var policy CryptoPolicy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read crypto_policy_file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("failed to parse crypto_policy_file %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// publicKeyDetails returns the algorithm and size of the cert's public key.
+func publicKeyDetails(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "rsa", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ecdsa", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "ed25519", ed25519.PublicKeySize * 8
+	}
+	return strings.ToLower(cert.PublicKeyAlgorithm.String()), 0
+}
+
+// check returns a problem if the key is of an algorithm the policy does not
+// allow, or smaller than it allows.
+func (p CryptoPolicy) check(algorithm string, bits int) string {
+	allowed := []string{}
+	for _, a := range p.Allow {
+		allowed = append(allowed, a.Algorithm)
+		if a.Algorithm != algorithm {
+			continue
+		}
+		if bits < a.MinBits {
+			return fmt.Sprintf("%s %d-bit key is below the crypto policy minimum of %d bits", algorithm, bits, a.MinBits)
+		}
+		return ""
+	}
+	return fmt.Sprintf("%s keys are not allowed by the crypto policy, which allows %s", algorithm, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// DomainsCSVConfig reads domains from a CSV inventory with a header row.
+// Every column that is not mapped to a setting becomes a label of the row's
+// domain, such as a team column.
+type DomainsCSVConfig struct {
+	Path string `yaml:"path,omitempty"`
+	// HostColumn, PortColumn and ThresholdColumn name the columns of the
+	// host, the port and the threshold in days. Only the host is required;
+	// rows with an empty port or threshold use the defaults.
+	HostColumn      string `yaml:"host_column,omitempty"`
+	PortColumn      string `yaml:"port_column,omitempty"`
+	ThresholdColumn string `yaml:"threshold_column,omitempty"`
+}
+
+func (c DomainsCSVConfig) columns() (string, string, string) {
+	host, port, threshold := "host", "port", "threshold"
+	if c.HostColumn != "" {
+		host = c.HostColumn
+	}
+	if c.PortColumn != "" {
+		port = c.PortColumn
+	}
+	if c.ThresholdColumn != "" {
+		threshold = c.ThresholdColumn
+	}
+	return host, port, threshold
+}
+
+// loadDomainsCSV reads one domain per row of the CSV. Errors name the line
+// of the offending row.
+func loadDomainsCSV(config DomainsCSVConfig) ([]DomainConfig, error) {
+	f, err := os.Open(config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domains_csv: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header of domains_csv %s: %w", config.Path, err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	hostColumn, portColumn, thresholdColumn := config.columns()
+	if !slices.Contains(header, hostColumn) {
+		return nil, fmt.Errorf("domains_csv %s has no %s column", config.Path, hostColumn)
+	}
+
+	domains := []DomainConfig{}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse domains_csv %s: %w", config.Path, err)
+		}
+		line, _ := r.FieldPos(0)
+		dc := DomainConfig{Labels: map[string]string{}}
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			if value == "" {
+				continue
+			}
+			switch column {
+			case hostColumn:
+				dc.Name = value
+			case portColumn:
+				port, err := strconv.Atoi(value)
+				if err != nil || port < 1 || port > 65535 {
+					return nil, fmt.Errorf("domains_csv %s line %d: invalid %s %q", config.Path, line, column, value)
+				}
+				dc.Port = port
+			case thresholdColumn:
+				threshold, err := strconv.Atoi(value)
+				if err != nil || threshold < 0 {
+					return nil, fmt.Errorf("domains_csv %s line %d: invalid %s %q", config.Path, line, column, value)
+				}
+				dc.Threshold = &threshold
+			default:
+				dc.Labels[column] = value
+			}
+		}
+		if dc.Name == "" {
+			return nil, fmt.Errorf("domains_csv %s line %d: the %s column is empty", config.Path, line, hostColumn)
+		}
+		domains = append(domains, dc)
+	}
+	return domains, nil
+}
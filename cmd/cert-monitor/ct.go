@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCTURL      = "https://crt.sh"
+	defaultCTInterval = 5 * time.Second
+)
+
+// CTConfig is where certificate transparency lookups are sent and how often.
+type CTConfig struct {
+	URL      string        `yaml:"url,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+type ctEntry struct {
+	SerialNumber string `json:"serial_number"`
+	IssuerName   string `json:"issuer_name"`
+	NotAfter     string `json:"not_after"`
+}
+
+var (
+	ctMu   sync.Mutex
+	ctLast time.Time
+)
+
+// checkCT looks up the currently valid certs logged for host. It reports
+// whether the served serial was logged and returns a problem for every
+// logged cert that is neither the served one nor in the known serials.
+func checkCT(ctx context.Context, config CTConfig, host string, served string, known []string) ([]string, error) {
+	entries, err := queryCT(ctx, config, host)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := map[string]bool{normalizeSerial(served): true}
+	for _, serial := range known {
+		allowed[normalizeSerial(serial)] = true
+	}
+
+	problems := []string{}
+	logged := false
+	reported := map[string]bool{}
+	for _, entry := range entries {
+		serial := normalizeSerial(entry.SerialNumber)
+		if serial == normalizeSerial(served) {
+			logged = true
+		}
+		if len(known) > 0 && !allowed[serial] && !reported[serial] {
+			reported[serial] = true
+			problems = append(problems, fmt.Sprintf("unexpected cert in CT logs: serial %s issued by %s", serial, entry.IssuerName))
+		}
+	}
+	if !logged {
+		problems = append(problems, "served cert not found in CT logs")
+	}
+	return problems, nil
+}
+
+// queryCT fetches the unexpired CT entries for host, waiting so lookups are
+// at least the configured interval apart.
+func queryCT(ctx context.Context, config CTConfig, host string) ([]ctEntry, error) {
+	base := config.URL
+	if base == "" {
+		base = defaultCTURL
+	}
+	interval := config.Interval
+	if interval == 0 {
+		interval = defaultCTInterval
+	}
+
+	ctMu.Lock()
+	if wait := interval - time.Since(ctLast); wait > 0 {
+		time.Sleep(wait)
+	}
+	ctLast = time.Now()
+	ctMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	query := url.Values{"q": {host}, "output": {"json"}, "exclude": {"expired"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ct log search returned %s", resp.Status)
+	}
+
+	var entries []ctEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse ct log search results: %w", err)
+	}
+	return entries, nil
+}
+
+// normalizeSerial lowercases a hex serial and strips separators and leading
+// zeros so serials from different sources compare equal.
+func normalizeSerial(serial string) string {
+	serial = strings.ToLower(strings.ReplaceAll(serial, ":", ""))
+	serial = strings.TrimLeft(serial, "0")
+	if serial == "" {
+		return "0"
+	}
+	return serial
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const defaultInterval = 24 * time.Hour
+
+// Event describes a change in a domain's status between two daemon cycles.
+type Event struct {
+	Time    time.Time
+	Domain  string
+	Event   string
+	Status  Status
+	Expires string
+	Error   string `json:",omitempty"`
+}
+
+// runDaemon checks the domains on the configured interval, within the check
+// window, until the process is stopped. With events enabled, only status
+// changes are printed, while notifications are still sent. On SIGUSR1, the
+// domains whose last check failed are checked again right away.
+func runDaemon(ctx context.Context, opts Options, events bool) {
+	config := ctx.Value(configKey{}).(*Config)
+	interval := config.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	// The event lines are the only output on stdout
+	if events {
+		opts.Print = false
+	}
+	retry := make(chan os.Signal, 1)
+	if signals := retrySignals(); len(signals) > 0 {
+		signal.Notify(retry, signals...)
+	}
+
+	previous := map[string]Domain{}
+	cycle := func(cfgDomains []DomainConfig) []Domain {
+		results := checkDomains(ctx, cfgDomains)
+		if events {
+			for _, event := range diffDomains(previous, results) {
+				out, err := json.Marshal(event)
+				if err != nil {
+					slog.Error("failed to encode event", "error", err.Error())
+					continue
+				}
+				fmt.Println(string(out))
+			}
+		}
+		for _, domain := range results {
+			previous[domain.NameRef] = domain
+		}
+		return results
+	}
+
+	for {
+		// Outside the check window nothing is checked until it opens again
+		if config.CheckWindow.enabled() {
+			wait, err := config.CheckWindow.untilOpen(time.Now())
+			if err != nil {
+				slog.Error("invalid check window", "error", err.Error())
+				os.Exit(1)
+			}
+			if wait > 0 {
+				slog.Debug(fmt.Sprintf("outside the check window, next check in %s", wait))
+				time.Sleep(wait)
+			}
+		}
+
+		results := cycle(config.Domains)
+		publish(ctx, results)
+		if err := report(ctx, succeeded(results), opts); err != nil {
+			slog.Error("failed to report results", "error", err.Error())
+		} else {
+			sendHeartbeat(ctx)
+		}
+
+		slog.Debug(fmt.Sprintf("next check in %s", interval))
+		next := time.After(interval)
+	wait:
+		for {
+			select {
+			case <-next:
+				break wait
+			case <-retry:
+				retryFailed(ctx, opts, cycle, previous)
+			}
+		}
+	}
+}
+
+// retryFailed checks only the domains whose last check failed, between two
+// regular cycles. Exporters get the latest result of every domain, while
+// only the retried ones are reported.
+func retryFailed(ctx context.Context, opts Options, cycle func([]DomainConfig) []Domain, previous map[string]Domain) {
+	config := ctx.Value(configKey{}).(*Config)
+	failed := []DomainConfig{}
+	for _, dc := range config.Domains {
+		if previous[dc.ref()].Status == StatusError {
+			failed = append(failed, dc)
+		}
+	}
+	if len(failed) == 0 {
+		slog.Warn("no domains failed their last check")
+		return
+	}
+	slog.Warn("retrying the domains that failed their last check", "domains", len(failed))
+	results := cycle(failed)
+	latest := []Domain{}
+	for _, domain := range previous {
+		latest = append(latest, domain)
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].NameRef < latest[j].NameRef })
+	publish(ctx, latest)
+	if err := report(ctx, succeeded(results), opts); err != nil {
+		slog.Error("failed to report results", "error", err.Error())
+	}
+}
+
+// diffDomains compares the results of a cycle against the previous cycle and
+// returns an event for every domain that changed. Domains seen for the first
+// time only produce an event if they are not OK.
+func diffDomains(previous map[string]Domain, results []Domain) []Event {
+	now := time.Now()
+	events := []Event{}
+	for _, cur := range results {
+		prev, seen := previous[cur.NameRef]
+		name := domainEvent(prev, seen, cur)
+		if name == "" {
+			continue
+		}
+		events = append(events, Event{
+			Time:    now,
+			Domain:  cur.NameRef,
+			Event:   name,
+			Status:  cur.Status,
+			Expires: cur.Expires,
+			Error:   cur.Error,
+		})
+	}
+	return events
+}
+
+// domainEvent names the transition from prev to cur, or returns an empty
+// string if nothing meaningful changed.
+func domainEvent(prev Domain, seen bool, cur Domain) string {
+	if seen && prev.Status != StatusError && cur.Status != StatusError && cur.Expires > prev.Expires {
+		return "renewed"
+	}
+	if seen && prev.Status == cur.Status {
+		return ""
+	}
+
+	switch cur.Status {
+	case StatusExpiring:
+		return "expiring"
+	case StatusExpired:
+		return "expired"
+	case StatusError:
+		return "error"
+	}
+	if !seen {
+		return ""
+	}
+	if prev.Status == StatusError {
+		return "recovered"
+	}
+	return "renewed"
+}
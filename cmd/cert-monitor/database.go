@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// MySQL capability flags sent in the SSLRequest packet.
+const (
+	mysqlClientLongPassword     = 0x00000001
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSSL              = 0x00000800
+	mysqlClientSecureConnection = 0x00008000
+)
+
+// negotiateMySQL reads the server's initial handshake and answers with an
+// SSLRequest packet, after which the server expects the TLS handshake.
+func negotiateMySQL(conn net.Conn) error {
+	seq, payload, err := readMySQLPacket(conn)
+	if err != nil {
+		return err
+	}
+	if len(payload) > 0 && payload[0] == 0xff {
+		if len(payload) > 3 {
+			return fmt.Errorf("server refused connection: %s", payload[3:])
+		}
+		return fmt.Errorf("server refused connection")
+	}
+	if len(payload) == 0 || payload[0] != 10 {
+		return fmt.Errorf("unsupported handshake protocol")
+	}
+
+	// protocol version, null terminated server version, connection id,
+	// first 8 bytes of auth data and a filler byte precede the capabilities
+	end := bytes.IndexByte(payload[1:], 0)
+	offset := 1 + end + 1 + 4 + 8 + 1
+	if end < 0 || len(payload) < offset+2 {
+		return fmt.Errorf("malformed handshake")
+	}
+	capabilities := binary.LittleEndian.Uint16(payload[offset:])
+	if capabilities&mysqlClientSSL == 0 {
+		return fmt.Errorf("server does not support TLS")
+	}
+
+	request := make([]byte, 32)
+	binary.LittleEndian.PutUint32(request[0:], mysqlClientLongPassword|mysqlClientProtocol41|mysqlClientSSL|mysqlClientSecureConnection)
+	binary.LittleEndian.PutUint32(request[4:], 1<<24)
+	request[8] = 33 // utf8_general_ci
+	return writeMySQLPacket(conn, seq+1, request)
+}
+
+func readMySQLPacket(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[3], payload, nil
+}
+
+func writeMySQLPacket(w io.Writer, seq byte, payload []byte) error {
+	length := len(payload)
+	packet := append([]byte{byte(length), byte(length >> 8), byte(length >> 16), seq}, payload...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// negotiateMongoDB does nothing, MongoDB servers expect the TLS handshake
+// as soon as the client connects. It exists so mongodb domains get the
+// default port.
+func negotiateMongoDB(conn net.Conn) error {
+	return nil
+}
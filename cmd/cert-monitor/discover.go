@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDiscoverPorts bounds discovery to an explicit, modest list of ports so
+// it stays a discovery aid rather than a port scanner.
+const maxDiscoverPorts = 1024
+
+// discoverTimeout bounds each port's check, since ports that do not speak
+// TLS may never answer the handshake.
+const discoverTimeout = 5 * time.Second
+
+// parsePorts parses a comma separated list of ports and ranges, such as
+// 443,8443,9000-9010.
+func parsePorts(list string) ([]int, error) {
+	ports := []int{}
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		low, high, isRange := strings.Cut(part, "-")
+		first, err := parsePort(low)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = parsePort(high); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid port range %s", part)
+			}
+		}
+		for port := first; port <= last; port++ {
+			ports = append(ports, port)
+			if len(ports) > maxDiscoverPorts {
+				return nil, fmt.Errorf("too many ports, at most %d can be discovered", maxDiscoverPorts)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports given")
+	}
+	return ports, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %s", s)
+	}
+	return port, nil
+}
+
+// discoverDomains returns a domain for every port on host. Ports that do not
+// serve TLS are dropped from the results instead of reported as errors.
+func discoverDomains(host string, ports []int) []DomainConfig {
+	domains := []DomainConfig{}
+	for _, port := range ports {
+		domains = append(domains, DomainConfig{Name: net.JoinHostPort(host, strconv.Itoa(port)), discover: true})
+	}
+	return domains
+}
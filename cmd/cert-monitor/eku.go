@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// extKeyUsages maps the usage names accepted in the config to the extended
+// key usages in a cert.
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"server_auth":      x509.ExtKeyUsageServerAuth,
+	"client_auth":      x509.ExtKeyUsageClientAuth,
+	"code_signing":     x509.ExtKeyUsageCodeSigning,
+	"email_protection": x509.ExtKeyUsageEmailProtection,
+	"time_stamping":    x509.ExtKeyUsageTimeStamping,
+	"ocsp_signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// checkEKU returns a problem naming the expected extended key usages the
+// cert lacks. A cert allowing any usage has all of them, while a cert
+// without the extension has none.
+func checkEKU(cert *x509.Certificate, expected []string) (string, error) {
+	missing := []string{}
+	for _, name := range expected {
+		usage, ok := extKeyUsages[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported extended key usage: %s", name)
+		}
+		if !slices.Contains(cert.ExtKeyUsage, usage) && !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageAny) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("missing extended key usage: %s", strings.Join(missing, ", ")), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	execTimeout = 30 * time.Second
+	// execMaxOutput bounds how much of a command's output is logged.
+	execMaxOutput = 1024
+)
+
+type ExecConfig struct {
+	// Command is run once per notifiable domain, with the same json as a
+	// webhook event on stdin. It only runs with -allow-exec.
+	Command string        `yaml:"command,omitempty"`
+	Args    []string      `yaml:"args,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// execNotifier hands each notifiable domain to an external command, for
+// channels that are not built in.
+type execNotifier struct {
+	config ExecConfig
+}
+
+func newExecNotifier(config ExecConfig) *execNotifier {
+	if config.Timeout <= 0 {
+		config.Timeout = execTimeout
+	}
+	return &execNotifier{config: config}
+}
+
+func (n *execNotifier) Name() string {
+	return "exec"
+}
+
+func (n *execNotifier) Notify(ctx context.Context, domains []Domain) error {
+	config := ctx.Value(configKey{}).(*Config)
+	var mu sync.Mutex
+	errs := []string{}
+	parallel(config.notifyConcurrency(), len(domains), func(i int) {
+		domain := domains[i]
+		event := webhookEventFor(domain, config.ResolvedNotifiers)
+		if event == "" {
+			return
+		}
+		err := n.run(ctx, webhookEvent{Event: event, Domain: domain, Header: config.NotificationHeader, Footer: config.NotificationFooter})
+		logReceipt(ctx, n.Name(), n.config.Command, []string{domain.NameRef}, err)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Sprintf("%s: %s", domain.NameRef, err.Error()))
+			mu.Unlock()
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// run pipes the payload to the command and logs how it exited along with
+// the start of its output.
+func (n *execNotifier) run(ctx context.Context, payload webhookEvent) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, n.config.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, n.config.Command, n.config.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if len(output) > execMaxOutput {
+		output = output[:execMaxOutput]
+	}
+	slog.Info("exec notifier finished", "command", n.config.Command, "domain", payload.Domain.NameRef,
+		"exit_code", cmd.ProcessState.ExitCode(), "output", output)
+	if err != nil {
+		if output != "" {
+			return fmt.Errorf("%s failed: %w: %s", n.config.Command, err, output)
+		}
+		return fmt.Errorf("%s failed: %w", n.config.Command, err)
+	}
+	return nil
+}
+
+// Check confirms the command can be found, without running it.
+func (n *execNotifier) Check(ctx context.Context) error {
+	_, err := exec.LookPath(n.config.Command)
+	return err
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// fdConn wraps an already connected socket inherited on fd, for supervisors
+// that hand the connection over instead of letting cert-monitor dial.
+func fdConn(fd int) (net.Conn, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d is not a connected socket: %w", fd, err)
+	}
+	return conn, nil
+}
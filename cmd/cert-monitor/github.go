@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const defaultGitHubAPIURL = "https://api.github.com"
+const defaultGitHubLabel = "cert-monitor"
+
+type GitHubConfig struct {
+	Token  string `yaml:"token,omitempty"`
+	Repo   string `yaml:"repo,omitempty"`
+	APIURL string `yaml:"api_url,omitempty"`
+	Label  string `yaml:"label,omitempty"`
+	// MinInterval is the least time between two issue updates.
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+}
+
+type githubIssue struct {
+	Number int    `json:"number"`
+	State  string `json:"state"`
+	Body   string `json:"body"`
+}
+
+// githubNotifier keeps one issue per domain in a GitHub repo. Issues are
+// opened (or reopened) while a domain is notifiable and closed once it is
+// healthy again. Each issue carries a marker in its body so it can be found
+// on later runs.
+type githubNotifier struct {
+	config GitHubConfig
+	client *http.Client
+}
+
+func newGitHubNotifier(config GitHubConfig) *githubNotifier {
+	if config.APIURL == "" {
+		config.APIURL = defaultGitHubAPIURL
+	}
+	if config.Label == "" {
+		config.Label = defaultGitHubLabel
+	}
+	return &githubNotifier{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (n *githubNotifier) Name() string {
+	return "github"
+}
+
+func (n *githubNotifier) Notify(ctx context.Context, domains []Domain) error {
+	issues, err := n.listIssues(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list issues: %w", err)
+	}
+
+	config := ctx.Value(configKey{}).(*Config)
+	var (
+		mu   sync.Mutex
+		errs []string
+	)
+	parallel(config.notifyConcurrency(), len(domains), func(i int) {
+		domain := domains[i]
+		marker := githubMarker(domain.NameRef)
+		var existing *githubIssue
+		for i := range issues {
+			if strings.Contains(issues[i].Body, marker) {
+				existing = &issues[i]
+				break
+			}
+		}
+
+		var err error
+		switch {
+		case domain.IsNotifiable() && existing == nil:
+			err = n.createIssue(ctx, domain)
+		case domain.IsNotifiable():
+			err = n.updateIssue(ctx, existing.Number, map[string]string{"state": "open", "body": githubBody(ctx, domain)})
+		case existing != nil && existing.State == "open":
+			if domain.Resolved && slices.Contains(config.ResolvedNotifiers, n.Name()) {
+				err = n.comment(ctx, existing.Number, resolvedMessage(domain))
+			}
+			if err == nil {
+				err = n.updateIssue(ctx, existing.Number, map[string]string{"state": "closed"})
+			}
+		default:
+			return
+		}
+		logReceipt(ctx, n.Name(), n.config.Repo, []string{domain.NameRef}, err)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Sprintf("%s: %s", domain.NameRef, err.Error()))
+			mu.Unlock()
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to update issues: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Check confirms the token can read the repo.
+func (n *githubNotifier) Check(ctx context.Context) error {
+	var repo struct {
+		Permissions struct {
+			Push bool `json:"push"`
+		} `json:"permissions"`
+	}
+	if err := n.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s", n.config.Repo), nil, &repo); err != nil {
+		return err
+	}
+	if !repo.Permissions.Push {
+		return fmt.Errorf("token cannot write issues in %s", n.config.Repo)
+	}
+	return nil
+}
+
+func (n *githubNotifier) listIssues(ctx context.Context) ([]githubIssue, error) {
+	issues := []githubIssue{}
+	for page := 1; ; page++ {
+		var batch []githubIssue
+		query := url.Values{
+			"state":    {"all"},
+			"labels":   {n.config.Label},
+			"per_page": {"100"},
+			"page":     {strconv.Itoa(page)},
+		}
+		path := fmt.Sprintf("/repos/%s/issues?%s", n.config.Repo, query.Encode())
+		if err := n.do(ctx, http.MethodGet, path, nil, &batch); err != nil {
+			return nil, err
+		}
+		issues = append(issues, batch...)
+		if len(batch) < 100 {
+			return issues, nil
+		}
+	}
+}
+
+func (n *githubNotifier) createIssue(ctx context.Context, domain Domain) error {
+	issue := map[string]any{
+		"title":  fmt.Sprintf("Certificate warning: %s", domain.NameRef),
+		"body":   githubBody(ctx, domain),
+		"labels": []string{n.config.Label},
+	}
+	return n.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues", n.config.Repo), issue, nil)
+}
+
+func (n *githubNotifier) updateIssue(ctx context.Context, number int, fields map[string]string) error {
+	return n.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%d", n.config.Repo, number), fields, nil)
+}
+
+func (n *githubNotifier) comment(ctx context.Context, number int, body string) error {
+	return n.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", n.config.Repo, number), map[string]string{"body": body}, nil)
+}
+
+func (n *githubNotifier) do(ctx context.Context, method string, path string, in any, out any) error {
+	if method != http.MethodGet {
+		throttleFor(n.Name()).wait(n.Name(), n.config.MinInterval)
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(n.config.APIURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+n.config.Token)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("github returned %s", resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// githubMarker identifies the issue tracking a domain.
+func githubMarker(domain string) string {
+	return fmt.Sprintf("<!-- cert-monitor:%s -->", domain)
+}
+
+func githubBody(ctx context.Context, domain Domain) string {
+	return fmt.Sprintf("%s\n%s", githubMarker(domain.NameRef), withBanner(ctx, fmt.Sprintf("```\n%s\n```\n", domain.Summary)))
+}
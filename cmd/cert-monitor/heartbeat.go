@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const heartbeatTimeout = 10 * time.Second
+
+// sendHeartbeat pings the dead man's switch URL so a missing ping reveals
+// that cert-monitor stopped running. Failures are only logged.
+func sendHeartbeat(ctx context.Context) {
+	config := ctx.Value(configKey{}).(*Config)
+	if config.HeartbeatURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.HeartbeatURL, nil)
+	if err != nil {
+		slog.Error("failed to send heartbeat", "error", err.Error())
+		return
+	}
+	req.Header.Set("User-Agent", "cert-monitor/"+VERSION)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("failed to send heartbeat", "error", err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("failed to send heartbeat", "error", fmt.Sprintf("unexpected status %s", resp.Status))
+	}
+}
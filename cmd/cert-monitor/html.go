@@ -0,0 +1,80 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// htmlReport is a standalone page, with its styles and the column sorting
+// inlined, so it can be served or opened without any other files.
+var htmlReport = template.Must(template.New("html-report").Funcs(template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Certificate status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 0.4em 0.8em; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+td.num { text-align: right; }
+tr.ok td.status { background: #d9f2d9; }
+tr.warning td.status { background: #fff1c2; }
+tr.critical td.status { background: #f8d0d0; }
+tr.problems td.problems { color: #a00; }
+.updated { color: #666; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Certificate status</h1>
+<p class="updated">Last updated {{.Updated}} &middot; {{len .Domains}} domains</p>
+<table id="domains">
+<thead>
+<tr><th>Domain</th><th>Common name</th><th>Issuer</th><th>Expires</th><th>Days left</th><th>Status</th><th>Severity</th><th>Problems</th></tr>
+</thead>
+<tbody>
+{{- range .Domains}}
+<tr class="{{lower (print .Severity)}}{{if .Problems}} problems{{end}}">
+<td>{{.NameRef}}</td><td>{{.CommonName}}</td><td>{{.Issuer}}</td><td>{{.Expires}}</td><td class="num">{{.DaysRemaining}}</td><td class="status">{{.Status}}</td><td class="status">{{.Severity}}</td><td class="problems">{{join .Problems "; "}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("#domains th").forEach(function (th, column) {
+  th.addEventListener("click", function () {
+    var tbody = document.querySelector("#domains tbody");
+    var ascending = th.dataset.order !== "asc";
+    th.dataset.order = ascending ? "asc" : "desc";
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[column].textContent, y = b.cells[column].textContent;
+      var cmp = isNaN(x) || isNaN(y) ? x.localeCompare(y) : x - y;
+      return ascending ? cmp : -cmp;
+    });
+    rows.forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// htmlFormatter writes a self-contained HTML status page, with rows colored
+// by severity and the time it was generated.
+type htmlFormatter struct{}
+
+func (htmlFormatter) Write(w io.Writer, domains []Domain) error {
+	return htmlReport.Execute(w, struct {
+		Updated string
+		Domains []Domain
+	}{
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Domains: domains,
+	})
+}
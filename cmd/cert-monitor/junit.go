@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",cdata"`
+}
+
+// junitFormatter writes a JUnit XML report with one test case per domain,
+// failing the domains that are expiring, expired or have problems.
+type junitFormatter struct{}
+
+func (junitFormatter) Write(w io.Writer, domains []Domain) error {
+	suite := junitTestSuite{Name: "cert-monitor", Tests: len(domains)}
+	var total float64
+	for _, d := range domains {
+		seconds := d.Timings.Total.Seconds()
+		total += seconds
+		tc := junitTestCase{Name: d.NameRef, ClassName: "cert-monitor", Time: fmt.Sprintf("%.3f", seconds)}
+		if d.IsNotifiable() {
+			suite.Failures++
+			message := fmt.Sprintf("%s: expires %s (%d days)", d.Status, d.Expires, d.DaysRemaining)
+			if len(d.Problems) > 0 {
+				message += ": " + strings.Join(d.Problems, "; ")
+			}
+			tc.Failure = &junitFailure{Message: message, Type: string(d.Severity), Contents: d.Summary}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
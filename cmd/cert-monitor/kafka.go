@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const kafkaTimeout = 10 * time.Second
+
+type KafkaConfig struct {
+	// Brokers are the host:port addresses used to reach the cluster.
+	Brokers []string `yaml:"brokers,omitempty"`
+	// Topic receives one json message per domain, keyed by the domain.
+	Topic string `yaml:"topic,omitempty"`
+}
+
+// exportKafka publishes each domain result as a json message, keyed by the
+// domain so the results of one domain stay in order on one partition.
+func exportKafka(ctx context.Context, config KafkaConfig, domains []Domain) error {
+	messages := []kafka.Message{}
+	for _, domain := range domains {
+		value, err := json.Marshal(domain)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(domain.NameRef), Value: value})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(config.Brokers...),
+		Topic:        config.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+		WriteTimeout: kafkaTimeout,
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, kafkaTimeout)
+	defer cancel()
+	return w.WriteMessages(ctx, messages...)
+}
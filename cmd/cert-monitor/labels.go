@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// labelRequirement is one term of a selector: the label must have the value,
+// or with negate must not.
+type labelRequirement struct {
+	key    string
+	value  string
+	negate bool
+}
+
+// labelSelector matches the domains whose labels meet every requirement.
+type labelSelector []labelRequirement
+
+// parseSelector parses a comma separated list of key=value and key!=value
+// terms, such as team=payments,env!=dev.
+func parseSelector(s string) (labelSelector, error) {
+	selector := labelSelector{}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		req := labelRequirement{}
+		key, value, found := strings.Cut(term, "!=")
+		if found {
+			req.negate = true
+		} else if key, value, found = strings.Cut(term, "="); !found {
+			return nil, fmt.Errorf("invalid selector term %q, expected key=value or key!=value", term)
+		}
+		req.key = strings.TrimSpace(key)
+		req.value = strings.TrimSpace(value)
+		if req.key == "" {
+			return nil, fmt.Errorf("invalid selector term %q, the label name is empty", term)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, req := range s {
+		if (labels[req.key] == req.value) == req.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// selectDomains returns the domains whose labels match the selector.
+func selectDomains(cfgDomains []DomainConfig, selector labelSelector) []DomainConfig {
+	selected := []DomainConfig{}
+	for _, dc := range cfgDomains {
+		if selector.matches(dc.Labels) {
+			selected = append(selected, dc)
+		}
+	}
+	return selected
+}
+
+// groupByLabel joins the domain summaries in sections by the value of the
+// label, with the domains that do not have it last.
+func groupByLabel(domains []Domain, label string) string {
+	sections := map[string][]string{}
+	unset := []string{}
+	for _, domain := range domains {
+		value, ok := domain.Labels[label]
+		if !ok {
+			unset = append(unset, domain.Summary, "")
+			continue
+		}
+		sections[value] = append(sections[value], domain.Summary, "")
+	}
+	values := []string{}
+	for value := range sections {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	lines := []string{}
+	for _, value := range values {
+		lines = append(lines, fmt.Sprintf("%s=%s (%d)", label, value, len(sections[value])/2), "")
+		lines = append(lines, sections[value]...)
+	}
+	if len(unset) > 0 {
+		lines = append(lines, fmt.Sprintf("no %s label (%d)", label, len(unset)/2), "")
+		lines = append(lines, unset...)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LogFileConfig writes logs to a file rotated by cert-monitor itself, for
+// deployments without a supervisor that captures stderr.
+type LogFileConfig struct {
+	Path string `yaml:"path,omitempty"`
+	// MaxSize is the size in megabytes at which the file is rotated,
+	// MaxAge how many days rotated files are kept and MaxBackups how many.
+	// Zero keeps lumberjack's defaults: 100MB, with no age or count limit.
+	MaxSize    int  `yaml:"max_size,omitempty"`
+	MaxAge     int  `yaml:"max_age,omitempty"`
+	MaxBackups int  `yaml:"max_backups,omitempty"`
+	Compress   bool `yaml:"compress,omitempty"`
+}
+
+// writer returns the rotating writer for the log file.
+func (c LogFileConfig) writer() io.Writer {
+	return &lumberjack.Logger{
+		Filename:   c.Path,
+		MaxSize:    c.MaxSize,
+		MaxAge:     c.MaxAge,
+		MaxBackups: c.MaxBackups,
+		Compress:   c.Compress,
+	}
+}
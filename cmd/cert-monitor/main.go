@@ -1,14 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
 
 	gomail "gopkg.in/mail.v2"
@@ -18,29 +32,538 @@ import (
 const VERSION = "0.1.4"
 
 type Config struct {
-	SMTP      SMTPConfig `yaml:"smtp,omitempty"`
-	Domains   []string   `yaml:"domains,omitempty"`
-	Threshold int        `yaml:"threshold,omitempty"`
+	SMTP        SMTPConfig       `yaml:"smtp,omitempty"`
+	Domains     []DomainConfig   `yaml:"domains,omitempty"`
+	Threshold   int              `yaml:"threshold,omitempty"`
+	MinLifetime int              `yaml:"min_lifetime,omitempty"`
+	MaxLifetime int              `yaml:"max_lifetime,omitempty"`
+	Verify      bool             `yaml:"verify,omitempty"`
+	Interval    time.Duration    `yaml:"interval,omitempty"`
+	OTel        OTelConfig       `yaml:"otel,omitempty"`
+	GitHub      GitHubConfig     `yaml:"github,omitempty"`
+	Statuspage  StatuspageConfig `yaml:"statuspage,omitempty"`
+	Severity    SeverityConfig   `yaml:"severity,omitempty"`
+	Dedupe      bool             `yaml:"dedupe,omitempty"`
+	StateFile   string           `yaml:"state_file,omitempty"`
+	CT          CTConfig         `yaml:"ct,omitempty"`
+	// RequireOCSPStaple flags servers that do not staple a valid, current
+	// OCSP response.
+	RequireOCSPStaple bool `yaml:"require_ocsp_staple,omitempty"`
+	// SessionResumption lets handshakes resume earlier sessions. By default
+	// every check does a fresh full handshake so the served cert is always read.
+	SessionResumption bool `yaml:"session_resumption,omitempty"`
+	// DefaultNotifiers names the notifiers used by domains that do not set
+	// their own. When empty, every configured notifier is used.
+	DefaultNotifiers []string `yaml:"default_notifiers,omitempty"`
+	// RequireValidUntil flags certs that expire before this date, regardless
+	// of the threshold.
+	RequireValidUntil time.Time `yaml:"require_valid_until,omitempty"`
+	// NotifyDelta holds back repeat email notifications for an expiring cert
+	// until its days remaining dropped by at least this many days, or it
+	// crossed into another severity or status. Requires StateFile.
+	NotifyDelta int `yaml:"notify_delta,omitempty"`
+	// CheckConcurrency is how many domains are checked at once, and
+	// NotifyConcurrency how many notifications a notifier sends at once.
+	CheckConcurrency  int `yaml:"check_concurrency,omitempty"`
+	NotifyConcurrency int `yaml:"notify_concurrency,omitempty"`
+	// LogFile writes logs to a rotated file instead of stderr.
+	LogFile LogFileConfig `yaml:"log_file,omitempty"`
+	// MaintenanceFile skips all notifications while the file exists. Checks
+	// still run and results are still recorded and printed.
+	MaintenanceFile string `yaml:"maintenance_file,omitempty"`
+	// ReportDir keeps the full results of every run as a timestamped json
+	// file, pruned to ReportRetention after each new report.
+	ReportDir       string          `yaml:"report_dir,omitempty"`
+	ReportRetention ReportRetention `yaml:"report_retention,omitempty"`
+	// NonWorkingDays escalates the threshold for certs expiring on weekends
+	// or holidays.
+	NonWorkingDays NonWorkingDaysConfig `yaml:"non_working_days,omitempty"`
+	// CheckChain flags servers that do not send the intermediates needed to
+	// reach the system roots, optionally confirmed against a bundle of known
+	// intermediates in IntermediatesFile.
+	CheckChain        bool   `yaml:"check_chain,omitempty"`
+	IntermediatesFile string `yaml:"intermediates_file,omitempty"`
+	// HeartbeatURL is requested after every run that completes, for a dead
+	// man's switch service that alerts when the pings stop.
+	HeartbeatURL string `yaml:"heartbeat_url,omitempty"`
+	// NotificationHeader and NotificationFooter are added before and after
+	// the body of every notification: emails, issues, Slack messages, and
+	// the webhook and exec payloads.
+	NotificationHeader string `yaml:"notification_header,omitempty"`
+	NotificationFooter string `yaml:"notification_footer,omitempty"`
+	// Vault is where domains with a vault secret read their canonical cert.
+	Vault VaultConfig `yaml:"vault,omitempty"`
+	// SummaryTemplate is a text/template for the body of the summary email,
+	// executed with SummaryData.
+	SummaryTemplate string `yaml:"summary_template,omitempty"`
+	// NetNS is the path of a Linux network namespace, such as
+	// /var/run/netns/mon, that connections to domains are made from. Names
+	// are still resolved on the host, with its resolv.conf, since Go's
+	// resolver does not stay on the thread that is switched into the
+	// namespace.
+	NetNS string `yaml:"netns,omitempty"`
+	// ResolvedNotifiers names the notifiers (email, github, slack, webhook)
+	// that confirm when a cert that was expiring or expired has been
+	// renewed. Requires StateFile.
+	ResolvedNotifiers []string `yaml:"resolved_notifiers,omitempty"`
+	// Kafka publishes every domain result to a topic after each run.
+	Kafka KafkaConfig `yaml:"kafka,omitempty"`
+	// ExpectedEKU lists the extended key usages every leaf must allow, such
+	// as server_auth. Domains can override it.
+	ExpectedEKU []string `yaml:"expected_eku,omitempty"`
+	// IssuerThresholds replaces Threshold for certs whose issuer common name
+	// or organization is a key, for CAs with longer renewal lead times.
+	IssuerThresholds map[string]int `yaml:"issuer_thresholds,omitempty"`
+	// RunRetries is how many more times a run in which no domain could be
+	// checked is repeated, RunRetryDelay apart.
+	RunRetries    int           `yaml:"run_retries,omitempty"`
+	RunRetryDelay time.Duration `yaml:"run_retry_delay,omitempty"`
+	// CheckWindow limits the checks of the daemon to certain hours and days.
+	CheckWindow CheckWindowConfig `yaml:"check_window,omitempty"`
+	// NotifyTrend adds how each domain changed since the previous run to its
+	// summary. Requires StateFile.
+	NotifyTrend bool `yaml:"notify_trend,omitempty"`
+	// FetchIntermediates follows the leaf's CA Issuers URLs to fetch the
+	// intermediates a server did not send when verification needs them,
+	// still flagging that they were missing.
+	FetchIntermediates bool `yaml:"fetch_intermediates,omitempty"`
+	// Slack posts a message per notifiable domain to an incoming webhook.
+	Slack SlackConfig `yaml:"slack,omitempty"`
+	// WildcardMinDepth flags certs with a wildcard name that has fewer labels
+	// below the wildcard, so 2 rejects *.com but allows *.example.com.
+	WildcardMinDepth int `yaml:"wildcard_min_depth,omitempty"`
+
+	// DedupKey is a template over the domain's fields deciding which alerts
+	// notify_delta treats as repeats, such as {{.NameRef}} {{.Fingerprint}}
+	// to alert again for every new cert. When empty, alerts for the same
+	// domain are repeats.
+	DedupKey string `yaml:"dedup_key,omitempty"`
+
+	// DomainsCSV adds the domains of a CSV inventory to Domains.
+	DomainsCSV DomainsCSVConfig `yaml:"domains_csv,omitempty"`
+
+	// Preflight checks that hosts can be resolved and reached before
+	// anything is checked, exiting with an error if not.
+	Preflight PreflightConfig `yaml:"preflight,omitempty"`
+	// DeliveryReceipts logs a receipt at info level for every notification
+	// sent or failed, naming the notifier, its target and the domain.
+	DeliveryReceipts bool `yaml:"delivery_receipts,omitempty"`
+	// TLSProfiles are named handshake settings that domains reference with
+	// tls_profile instead of repeating them.
+	TLSProfiles map[string]TLSProfile `yaml:"tls_profiles,omitempty"`
+	// Webhook posts the results as json, per notifiable domain or as one
+	// batch per run.
+	Webhook WebhookConfig `yaml:"webhook,omitempty"`
+	// Source identifies this instance in metrics, notifications and output
+	// when several report to the same backend, such as a region. It
+	// defaults to the hostname.
+	Source string `yaml:"source,omitempty"`
+	// CryptoPolicy flags certs whose public key is not of an allowed
+	// algorithm and size. CryptoPolicyFile replaces it with the policy in a
+	// file shared across configs.
+	CryptoPolicy     CryptoPolicy `yaml:"crypto_policy,omitempty"`
+	CryptoPolicyFile string       `yaml:"crypto_policy_file,omitempty"`
+	// MinDaysFile is rewritten after every run with only the fewest days
+	// remaining across all domains, like -min-days.
+	MinDaysFile string `yaml:"min_days_file,omitempty"`
+	// Freeze flags certs that would expire during a change freeze, when
+	// they cannot be renewed, so they are renewed before it starts.
+	Freeze FreezeConfig `yaml:"freeze,omitempty"`
+	// Exec runs an external command as a notifier, for channels that are
+	// not built in.
+	Exec ExecConfig `yaml:"exec,omitempty"`
+	// CheckChainOrder flags servers that send their chain out of order,
+	// which strict clients reject even when every cert is there.
+	CheckChainOrder bool `yaml:"check_chain_order,omitempty"`
+}
+
+// FreezeConfig is a change freeze running from Start, or now when unset,
+// through the whole day of End.
+type FreezeConfig struct {
+	Start time.Time `yaml:"start,omitempty"`
+	End   time.Time `yaml:"end,omitempty"`
+}
+
+// covers reports whether t falls within the freeze, which starts at now
+// when no start is set.
+func (f FreezeConfig) covers(now time.Time, t time.Time) bool {
+	start := f.Start
+	if start.IsZero() {
+		start = now
+	}
+	if f.End.IsZero() || t.Before(start) {
+		return false
+	}
+	return t.Before(f.End.AddDate(0, 0, 1))
+}
+
+// source returns the configured source, or the hostname.
+func (c Config) source() string {
+	if c.Source != "" {
+		return c.Source
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+const redactedValue = "REDACTED"
+
+// hasSecrets reports whether the config holds any value that redacted
+// masks, so the permissions check follows the same list of secrets.
+func (c Config) hasSecrets() bool {
+	plain, err := yaml.Marshal(c)
+	if err != nil {
+		return false
+	}
+	masked, err := yaml.Marshal(c.redacted())
+	if err != nil {
+		return false
+	}
+	return !bytes.Equal(plain, masked)
+}
+
+// redacted returns a copy of the config with secrets masked so it is safe to
+// print. URLs whose path is the credential, such as webhooks and heartbeat
+// pings, count as secrets, as do all headers, which carry tokens.
+func (c Config) redacted() Config {
+	for _, secret := range []*string{
+		&c.GitHub.Token,
+		&c.Statuspage.APIKey,
+		&c.Slack.WebhookURL,
+		&c.Webhook.URL,
+		&c.HeartbeatURL,
+		&c.Vault.Token,
+		&c.Vault.RoleID,
+		&c.Vault.SecretID,
+	} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	c.OTel.Headers = redactedHeaders(c.OTel.Headers)
+	c.Webhook.Headers = redactedHeaders(c.Webhook.Headers)
+	domains := []DomainConfig{}
+	for _, dc := range c.Domains {
+		if dc.Password != "" {
+			dc.Password = redactedValue
+		}
+		if dc.SMTPAuth.Password != "" {
+			dc.SMTPAuth.Password = redactedValue
+		}
+		dc.HTTPProbe.Headers = redactedHeaders(dc.HTTPProbe.Headers)
+		dc.HTTPUpgrade.Headers = redactedHeaders(dc.HTTPUpgrade.Headers)
+		domains = append(domains, dc)
+	}
+	c.Domains = domains
+	return c
+}
+
+// redactedHeaders returns a copy of the headers with every value masked.
+func redactedHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	masked := map[string]string{}
+	for k := range headers {
+		masked[k] = redactedValue
+	}
+	return masked
 }
 
+// sessionCache is shared by all checks when session resumption is enabled.
+var sessionCache = tls.NewLRUClientSessionCache(0)
+
 type SMTPConfig struct {
-	Server string   `yaml:"server,omitempty"`
-	Port   int      `yaml:"port,omitempty"`
-	To     []string `yaml:"to,omitempty"`
-	From   string   `yaml:"from,omitempty"`
+	Server  string        `yaml:"server,omitempty"`
+	Port    int           `yaml:"port,omitempty"`
+	To      []string      `yaml:"to,omitempty"`
+	From    string        `yaml:"from,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MinInterval is the least time between two emails.
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+	// MessageIDDomain is the domain of the Message-ID header set on each
+	// email. Without it no Message-ID is set and the relay may add one.
+	MessageIDDomain string `yaml:"message_id_domain,omitempty"`
+}
+
+const defaultSMTPTimeout = 30 * time.Second
+
+// DomainConfig holds the per-domain settings. A domain can be listed as a
+// plain hostname or as a mapping when it needs extra settings.
+type DomainConfig struct {
+	Name              string `yaml:"name,omitempty"`
+	ExpectedPolicyOID string `yaml:"expected_policy_oid,omitempty"`
+	Verify            *bool  `yaml:"verify,omitempty"`
+	// File checks a local PEM file, or a PKCS#12 bundle (.p12/.pfx) opened
+	// with Password, instead of dialing Name.
+	File     string `yaml:"file,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// Port defaults to 443, or the protocol's port for starttls domains, and
+	// can also be given as part of the name.
+	Port int `yaml:"port,omitempty"`
+	// StartTLS upgrades a plaintext protocol connection to TLS before the
+	// cert is read: smtp, imap, pop3, mysql or mongodb. SMTPAuth optionally
+	// authenticates after an smtp upgrade.
+	StartTLS string         `yaml:"starttls,omitempty"`
+	SMTPAuth SMTPAuthConfig `yaml:"smtp_auth,omitempty"`
+	// HTTPProbe sends a request with custom headers once connected.
+	HTTPProbe HTTPProbeConfig `yaml:"http_probe,omitempty"`
+	// CTCheck confirms the served cert is in the CT logs and flags any other
+	// logged cert whose serial is not in CTKnownSerials.
+	CTCheck        bool     `yaml:"ct_check,omitempty"`
+	CTKnownSerials []string `yaml:"ct_known_serials,omitempty"`
+	// Notifiers names the notifiers this domain's alerts are routed to.
+	Notifiers []string `yaml:"notifiers,omitempty"`
+	// CheckAllIPs checks the cert served on every resolved address instead
+	// of only the first reachable one, flagging any that differ.
+	CheckAllIPs bool `yaml:"check_all_ips,omitempty"`
+
+	// ExactNames flags the cert unless its DNS names are exactly these,
+	// catching names added as well as names dropped by a reissue.
+	ExactNames []string `yaml:"exact_names,omitempty"`
+
+	// SPKIPin is the base64 SHA-256 of the expected public key, so reissues
+	// with the same key pass but a key change is flagged.
+	SPKIPin string `yaml:"spki_pin,omitempty"`
+
+	// Renegotiate accepts one renegotiation requested by the server, for
+	// legacy servers that only present the right cert once a request was
+	// made. It limits the connection to TLS 1.2 and sends the http_probe
+	// request, or GET /, to prompt the server.
+	Renegotiate bool `yaml:"renegotiate,omitempty"`
+
+	// AllowUnreachable ignores refused and timed out connections, for
+	// endpoints that are expected to be down at times. Other errors, such as
+	// failed handshakes, still count.
+	AllowUnreachable bool `yaml:"allow_unreachable,omitempty"`
+
+	// Vault flags the domain if it does not serve the cert stored in this
+	// Vault secret.
+	Vault VaultCertConfig `yaml:"vault,omitempty"`
+
+	// HTTPUpgrade upgrades a plaintext HTTP connection to TLS with an
+	// Upgrade request before the cert is read, instead of StartTLS.
+	HTTPUpgrade HTTPUpgradeConfig `yaml:"http_upgrade,omitempty"`
+
+	// RejectBelow flags the domain if it still completes a handshake with a
+	// TLS version older than this one (1.1, 1.2 or 1.3), which takes an
+	// extra handshake.
+	RejectBelow string `yaml:"reject_below,omitempty"`
+
+	// ProbeName is sent as the SNI instead of Name, such as a subdomain
+	// covered by a wildcard cert, and the cert is flagged unless it covers
+	// the name. Verification is done against it too.
+	ProbeName string `yaml:"probe_name,omitempty"`
+
+	// ExpectedEKU replaces the global expected_eku for this domain.
+	ExpectedEKU []string `yaml:"expected_eku,omitempty"`
+
+	// Address is connected to instead of resolving Name, which is still
+	// sent as the SNI. With ProbeNames, each name is checked as the SNI
+	// against Address in its own handshake, as a result of its own unless
+	// the same cert was served.
+	Address    string   `yaml:"address,omitempty"`
+	ProbeNames []string `yaml:"probe_names,omitempty"`
+
+	// conn is an already connected socket to use instead of dialing.
+	conn net.Conn
+	// discover drops the domain from the results if it does not serve TLS.
+	discover bool
+	// Labels are free-form key/value pairs, such as team: payments, that
+	// -select and -group-by work on.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// RunbookURL links to how this domain's cert is renewed, shown as a
+	// button in Slack Block Kit messages.
+	RunbookURL string `yaml:"runbook_url,omitempty"`
+
+	// ExpectedFingerprint and ExpectedCommonName flag the domain unless the
+	// served cert has this hex SHA-256 fingerprint and common name.
+	ExpectedFingerprint string `yaml:"expected_fingerprint,omitempty"`
+	ExpectedCommonName  string `yaml:"expected_common_name,omitempty"`
+
+	// SNIMap is a file mapping SNIs to the cert each should yield. Every
+	// mapping is checked against Address, or its own name without one, as a
+	// result of its own with the SNI as the probe_name.
+	SNIMap string `yaml:"sni_map,omitempty"`
+
+	// TLSProfile names the entry of tls_profiles whose settings are used for
+	// the handshake.
+	TLSProfile string `yaml:"tls_profile,omitempty"`
+
+	// Threshold replaces the global and issuer thresholds for this domain
+	// when set, 0 included, which only alerts on expired certs.
+	Threshold *int `yaml:"threshold,omitempty"`
+
+	// probeGroup is shared by the entries expanded from one's ProbeNames.
+	probeGroup string
+}
+
+type SMTPAuthConfig struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+const defaultPort = "443"
+
+// hostPort splits the domain into the host to dial and the port, which may be
+// part of the name or set separately.
+func (dc DomainConfig) hostPort() (string, string) {
+	if host, port, err := net.SplitHostPort(dc.Name); err == nil {
+		return host, port
+	}
+	if dc.Port != 0 {
+		return dc.Name, strconv.Itoa(dc.Port)
+	}
+	if port, ok := startTLSPorts[dc.StartTLS]; ok {
+		return dc.Name, port
+	}
+	return dc.Name, defaultPort
+}
+
+// ref is how the domain is referred to in results and logs.
+func (dc DomainConfig) ref() string {
+	if dc.Name == "" {
+		return dc.File
+	}
+	if dc.Address != "" {
+		return dc.Name + "@" + dc.Address
+	}
+	return dc.Name
 }
 
+// expandProbeNames replaces every entry with probe_names by one entry per
+// name, connecting to the entry's address.
+func expandProbeNames(cfgDomains []DomainConfig) []DomainConfig {
+	expanded := []DomainConfig{}
+	for i, dc := range cfgDomains {
+		if len(dc.ProbeNames) == 0 {
+			expanded = append(expanded, dc)
+			continue
+		}
+		for _, name := range dc.ProbeNames {
+			probe := dc
+			probe.Name = name
+			probe.ProbeName = name
+			probe.ProbeNames = nil
+			probe.probeGroup = strconv.Itoa(i)
+			expanded = append(expanded, probe)
+		}
+	}
+	return expanded
+}
+
+func (dc *DomainConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		dc.Name = value.Value
+		return nil
+	}
+	type plain DomainConfig
+	return value.Decode((*plain)(dc))
+}
+
+// Status is the expiry classification of a domain's certificate.
+type Status string
+
+const (
+	StatusOK       Status = "OK"
+	StatusExpiring Status = "EXPIRING SOON"
+	StatusExpired  Status = "EXPIRED"
+	StatusError    Status = "ERROR"
+)
+
 type Domain struct {
 	NameRef        string
+	Source         string
+	Port           string
 	CommonName     string
 	DNSNames       []string
+	IPNames        []string
+	Hostnames      []string
+	Fingerprint    string
+	SPKIHash       string
+	KeyAlgorithm   string
+	KeyBits        int
+	Serial         string
+	PolicyOIDs     []string
+	Chain          []ChainCert
+	Notifiers      []string
+	Labels         map[string]string
+	RunbookURL     string
+	Issuer         string
+	IssuerURLs     []string
+	OCSPServers    []string
+	Issued         string
 	Expires        string
+	ExpiresOffDay  bool
+	ExpiresIn      string
+	DaysRemaining  int
+	LifetimeDays   int
+	ElapsedPercent float64
 	IsExpiringSoon bool
+	Status         Status
+	Severity       Severity
+	Verified       bool
+	VerifiedChains []string
+	VerifyError    string
+	MustStaple     bool
+	OCSPStapled    bool
+	OCSPStatus     string
+	OCSPNextUpdate string
+	Quiet          bool
+	Resolved       bool
+	Trend          string
+	HTTPStatus     int
+	AddressCerts   map[string]string
+	Timings        Timings
+	Problems       []string
+	Error          string
 	Summary        string
+	// IncompleteChain is set when the server did not send every
+	// intermediate needed to reach the system roots.
+	IncompleteChain bool
+	// MisorderedChain is set when a served cert is not signed by the one
+	// sent after it.
+	MisorderedChain bool
+	// TCPConnectSeconds and TLSHandshakeSeconds split the time to connect
+	// into the network and the TLS negotiation cost.
+	TCPConnectSeconds   float64
+	TLSHandshakeSeconds float64
+
+	// probeGroup is shared by the results of one entry's probe_names.
+	probeGroup string
+}
+
+// Timings records how long each phase of connecting to a domain took.
+type Timings struct {
+	DNS       time.Duration
+	Connect   time.Duration
+	Handshake time.Duration
+	Total     time.Duration
+}
+
+// IsNotifiable reports whether the domain should trigger a notification,
+// either because it is expiring or because a check flagged a problem.
+func (d *Domain) IsNotifiable() bool {
+	return d.IsExpiringSoon || len(d.Problems) > 0
 }
 
 type configKey struct{}
 
+// setLogger makes the default logger write to w at the given level.
+func setLogger(w io.Writer, json bool, level slog.Leveler) {
+	var h slog.Handler
+	if json {
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	} else {
+		h = slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	slog.SetDefault(slog.New(h))
+}
+
 func main() {
 	var (
 		config Config
@@ -50,10 +573,37 @@ func main() {
 
 	var configFlag = flag.String("config", "", "path to config file")
 	var summaryFlag = flag.Bool("summary", false, "show summary information")
+	var groupFlag = flag.Bool("group", false, "group summary by status")
+	var groupByFlag = flag.String("group-by", "", "group summary by the value of this label")
+	var selectFlag = flag.String("select", "", "only check the domains whose labels match, e.g. team=payments,env!=dev")
 	var debugFlag = flag.Bool("debug", false, "show debug output")
 	var jsonFlag = flag.Bool("json", false, "format output in json")
+	var formatFlag = flag.String("format", "", fmt.Sprintf("output format (%s)", strings.Join(formatterNames(), ", ")))
 	var printFlag = flag.Bool("print", false, "print to stdout instead of email")
+	var outputFlag = flag.String("output", "", "with -print, write to this file instead of stdout")
+	var rawFlag = flag.Bool("raw", false, "leave the fields meant for people out of json and csv output")
 	var versionFlag = flag.Bool("version", false, "print version and exit")
+	var checkNotifiersFlag = flag.Bool("check-notifiers", false, "check that every notifier is configured and reachable, without sending")
+	var resolveOnlyFlag = flag.Bool("resolve-only", false, "only resolve the domains and print their addresses")
+	var statsFlag = flag.Bool("stats", false, "print timing and success statistics to stderr after the checks")
+	var exitCodeFlag = flag.Bool("exit-code", false, "exit 1 on warning, 2 on critical and 3 when a domain could not be checked")
+	var printConfigFlag = flag.Bool("print-config", false, "print the resolved config and exit")
+	var checkConfigFlag = flag.Bool("check-config", false, "validate the config, print every problem found and exit")
+	var daemonFlag = flag.Bool("daemon", false, "keep running and check on the configured interval")
+	var eventsFlag = flag.Bool("events", false, "in daemon mode, print only status changes as json lines, still sending notifications")
+	var summaryFDFlag = flag.Int("summary-fd", -1, "write the summary to this inherited file descriptor instead of emailing it, implies -summary")
+	var fdFlag = flag.Int("fd", -1, "check the cert over the already connected socket on this file descriptor instead of the configured domains")
+	var fdNameFlag = flag.String("fd-name", "", "with -fd, the server name sent as SNI and used for verification")
+	var retryFailedFlag = flag.Bool("retry-failed", false, "only check the domains whose last check failed, using the state file")
+	var minExpiryFlag = flag.Bool("min-expiry", false, "print only the soonest expiry date across all domains and exit")
+	var minDaysFlag = flag.Bool("min-days", false, "print only the fewest days remaining across all domains and exit")
+	var expireBeforeFlag = flag.String("expire-before", "", "only report the certs that expire before this date (YYYY-MM-DD), regardless of the threshold")
+	var countExpiringFlag = flag.Bool("count-expiring", false, "print only the number of certs within the threshold, expired ones included, and exit")
+	var discoverFlag = flag.String("discover", "", "check every port in -ports on this host, reporting the ones that serve TLS")
+	var portsFlag = flag.String("ports", "443", "with -discover, a comma separated list of ports and ranges, e.g. 443,8443,9000-9010")
+	var strictPermissionsFlag = flag.Bool("strict-permissions", false, "refuse to run if a config file holding secrets is world-readable")
+	var allowExecFlag = flag.Bool("allow-exec", false, "allow the exec notifier to run its command")
+	var stdinPEMFlag = flag.Bool("stdin-pem", false, "analyze a PEM cert read from stdin and exit, no config needed")
 	flag.Parse()
 
 	if *versionFlag {
@@ -64,141 +614,1259 @@ func main() {
 	// Configure logging
 	var programLevel = new(slog.LevelVar)
 	programLevel.Set(slog.LevelWarn)
-	var h slog.Handler
-	if *jsonFlag {
-		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: programLevel})
-	} else {
-		h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: programLevel})
-	}
-	logger := slog.New(h)
-	slog.SetDefault(logger)
+	setLogger(os.Stderr, *jsonFlag, programLevel)
 	if *debugFlag {
 		programLevel.Set(slog.LevelDebug)
 	}
 
-	// Load config and store in ctx
+	// Analyze a pasted cert on its own, without loading any config
+	if *stdinPEMFlag {
+		ctx = context.WithValue(ctx, configKey{}, &config)
+		d, err := getDomain(ctx, DomainConfig{File: stdinPath})
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to analyze cert from stdin: %s", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(d.Summary)
+		os.Exit(0)
+	}
+
+	// Load config and store in ctx. The file can be skipped entirely when
+	// the domains come from the environment.
 	configFilePath, err := getConfigPath(*configFlag)
-	if err != nil {
+	_, envDomains := os.LookupEnv("CERT_MONITOR_DOMAINS")
+	if err != nil && !envDomains && *fdFlag < 0 && *discoverFlag == "" {
 		slog.Error("no config file path provided by -config flag or CERT_MONITOR_CONFIG_PATH environment variable")
 		os.Exit(1)
 	}
-	d, err := os.ReadFile(configFilePath)
-	if err != nil {
-		slog.Error(fmt.Sprintf("failed to read config file: %s\n", configFilePath))
+	if err == nil {
+		d, err := os.ReadFile(configFilePath)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to read config file: %s\n", configFilePath))
+			os.Exit(1)
+		}
+		err = yaml.Unmarshal(d, &config)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to parse config file: %s\n", err.Error()))
+			os.Exit(1)
+		}
+		// Credentials in the file should not be readable by everyone
+		if config.hasSecrets() {
+			if err := checkConfigPermissions(configFilePath); err != nil {
+				if *strictPermissionsFlag {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				slog.Warn(err.Error())
+			}
+		}
+	}
+	if err := applyEnv(&config); err != nil {
+		slog.Error(fmt.Sprintf("failed to apply environment: %s", err.Error()))
+		os.Exit(1)
+	}
+	if config.LogFile.Path != "" {
+		setLogger(config.LogFile.writer(), *jsonFlag, programLevel)
+	}
+	// Receipts and the results of the exec notifier are logged at info,
+	// which is below the default level
+	if (config.DeliveryReceipts || config.Exec.Command != "") && !*debugFlag {
+		programLevel.Set(slog.LevelInfo)
+	}
+	if config.CryptoPolicyFile != "" {
+		config.CryptoPolicy, err = loadCryptoPolicy(config.CryptoPolicyFile)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if config.DomainsCSV.Path != "" {
+		csvDomains, err := loadDomainsCSV(config.DomainsCSV)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		config.Domains = append(config.Domains, csvDomains...)
+	}
+	// Every problem in the config is reported at once, before anything runs
+	if problems := config.validate(); len(problems) > 0 {
+		for _, problem := range problems {
+			slog.Error("invalid config", "problem", problem)
+		}
 		os.Exit(1)
 	}
-	err = yaml.Unmarshal(d, &config)
+	if *checkConfigFlag {
+		fmt.Println("config is valid")
+		return
+	}
+	// The config alone must not be enough to run arbitrary commands
+	if config.Exec.Command != "" && !*allowExecFlag {
+		slog.Error("exec.command is set, run with -allow-exec to enable the exec notifier")
+		os.Exit(1)
+	}
+	config.Domains, err = expandSNIMaps(config.Domains)
 	if err != nil {
-		slog.Error(fmt.Sprintf("failed to parse config file: %s\n", err.Error()))
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
+	config.Domains = expandProbeNames(config.Domains)
+	if *selectFlag != "" {
+		selector, err := parseSelector(*selectFlag)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		config.Domains = selectDomains(config.Domains, selector)
+	}
+	// Discovering a host's TLS ports replaces the configured domains
+	if *discoverFlag != "" {
+		ports, err := parsePorts(*portsFlag)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		config.Domains = discoverDomains(*discoverFlag, ports)
+	}
+
+	// A socket handed over by a supervisor replaces the configured domains
+	if *fdFlag >= 0 {
+		if *fdNameFlag == "" {
+			slog.Error("-fd requires -fd-name")
+			os.Exit(1)
+		}
+		// The socket can only be handshaken over once
+		if *daemonFlag || config.RunRetries > 0 {
+			slog.Error("-fd cannot be combined with -daemon or run_retries, the socket can only be checked once")
+			os.Exit(1)
+		}
+		conn, err := fdConn(*fdFlag)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		config.Domains = []DomainConfig{{Name: *fdNameFlag, conn: conn}}
+	}
 	ctx = context.WithValue(ctx, configKey{}, &config)
 
-	// build the domain information
-	var domains []Domain
-	for _, cfgDomain := range config.Domains {
-		slog.Debug(fmt.Sprintf("checking domain: %s", cfgDomain))
+	if *printConfigFlag {
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		redacted := config.redacted()
+		if err := enc.Encode(&redacted); err != nil {
+			slog.Error(fmt.Sprintf("failed to encode config: %s", err.Error()))
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// -json implies the json format for printed output unless -format is given
+	format := *formatFlag
+	if format == "" {
+		format = "text"
+		if *jsonFlag && *printFlag {
+			format = "json"
+		}
+	}
+	if _, ok := formatters[format]; !ok {
+		slog.Error(fmt.Sprintf("unknown format %q, available formats: %s", format, strings.Join(formatterNames(), ", ")))
+		os.Exit(1)
+	}
+
+	opts := Options{
+		Summary: *summaryFlag,
+		Group:   *groupFlag,
+		GroupBy: *groupByFlag,
+		Format:  format,
+		Print:   *printFlag,
+		Output:  *outputFlag,
+		Raw:     *rawFlag,
+	}
+	// The summary on the descriptor replaces the per-domain emails, as
+	// -summary does
+	if *summaryFDFlag >= 0 {
+		opts.Summary = true
+		opts.SummaryFile, err = summaryFile(*summaryFDFlag)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	if *expireBeforeFlag != "" {
+		opts.ExpireBefore, err = time.Parse("2006-01-02", *expireBeforeFlag)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid -expire-before date %q, expected YYYY-MM-DD", *expireBeforeFlag))
+			os.Exit(1)
+		}
+	}
 
-		domain, err := getDomain(ctx, cfgDomain)
+	// Narrow the domains to the ones that failed last time
+	if *retryFailedFlag {
+		// The daemon would otherwise never check the healthy domains again
+		if *daemonFlag {
+			slog.Error("-retry-failed cannot be combined with -daemon, send the daemon SIGUSR1 to retry its failed domains instead")
+			os.Exit(1)
+		}
+		if config.StateFile == "" {
+			slog.Error("-retry-failed requires a state_file")
+			os.Exit(1)
+		}
+		state, err := loadState(config.StateFile)
 		if err != nil {
-			slog.Error("failed to dial domain", "error", err.Error())
-			continue
+			slog.Error("failed to load state", "error", err.Error())
+			os.Exit(1)
 		}
-		slog.Debug("domain", "domain", domain)
+		config.Domains = failedDomains(state, config.Domains)
+		if len(config.Domains) == 0 {
+			slog.Warn("no domains failed their last check")
+			return
+		}
+	}
 
-		domains = append(domains, *domain)
+	if *checkNotifiersFlag {
+		if !checkNotifiers(ctx, os.Stdout) {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// one email per domain that is expiring soon
-	if !*summaryFlag && !*printFlag {
-		for _, domain := range domains {
+	if *resolveOnlyFlag {
+		printResolved(ctx, os.Stdout, config.Domains)
+		return
+	}
+
+	// A broken environment fails everything, so it is reported once instead
+	if config.Preflight.enabled() {
+		if err := preflight(ctx, config.Domains); err != nil {
+			slog.Error("preflight failed", "error", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if *daemonFlag {
+		runDaemon(ctx, opts, *eventsFlag)
+		return
+	}
+
+	if *minExpiryFlag || *minDaysFlag {
+		soonest, found := soonestExpiry(checkDomains(ctx, config.Domains))
+		if !found {
+			slog.Error("no domain could be checked")
+			os.Exit(1)
+		}
+		if *minDaysFlag {
+			fmt.Println(soonest.DaysRemaining)
+		} else {
+			fmt.Println(soonest.Expires)
+		}
+		return
+	}
+
+	if *countExpiringFlag {
+		count := 0
+		for _, domain := range checkDomains(ctx, config.Domains) {
 			if domain.IsExpiringSoon {
-				subject := fmt.Sprintf("certificate expiration warning: %s", domain.NameRef)
-				sendEmail(ctx, subject, domain.Summary)
+				count++
 			}
 		}
+		fmt.Println(count)
+		return
 	}
 
-	// email the summary if requested
-	if *summaryFlag {
-		summaryLines := []string{}
-		for _, domain := range domains {
-			summaryLines = append(summaryLines, domain.Summary)
-			summaryLines = append(summaryLines, "")
+	start := time.Now()
+	results := checkDomains(ctx, config.Domains)
+	if *statsFlag {
+		printStats(os.Stderr, results, time.Since(start))
+	}
+	publish(ctx, results)
+	if err := report(ctx, succeeded(results), opts); err != nil {
+		slog.Error("failed to report results", "error", err.Error())
+		os.Exit(1)
+	}
+	sendHeartbeat(ctx)
+	if *exitCodeFlag {
+		os.Exit(exitCode(results))
+	}
+}
+
+// Options are the output settings chosen on the command line.
+type Options struct {
+	Summary bool
+	Group   bool
+	GroupBy string
+	Format  string
+	Print   bool
+	Output  string
+	Raw     bool
+	// SummaryFile receives the summary instead of email, when set.
+	SummaryFile *os.File
+	// ExpireBefore narrows the results to the certs that expire before
+	// this date, when set.
+	ExpireBefore time.Time
+}
+
+// checkDomains checks every configured domain. Domains that could not be
+// checked are included with their Status set to StatusError.
+func checkDomains(ctx context.Context, cfgDomains []DomainConfig) []Domain {
+	config := ctx.Value(configKey{}).(*Config)
+	domains := runChecks(ctx, cfgDomains)
+
+	// A run where no domain could be checked is retried, for transient
+	// failures such as DNS being down at startup
+	for attempt := 1; attempt <= config.RunRetries && allFailed(domains); attempt++ {
+		slog.Warn("no domain could be checked, retrying the run", "attempt", attempt, "delay", config.runRetryDelay().String())
+		time.Sleep(config.runRetryDelay())
+		domains = runChecks(ctx, cfgDomains)
+	}
+
+	if config.StateFile != "" {
+		state, err := loadState(config.StateFile)
+		if err != nil {
+			slog.Error("failed to load state", "error", err.Error())
+		} else {
+			applyState(state, domains, config.NotifyDelta, config.NotifyTrend, config.dedupKey())
+			if err := saveState(config.StateFile, state); err != nil {
+				slog.Error("failed to save state", "error", err.Error())
+			}
+		}
+	}
+	domains = dedupeProbeNames(domains)
+	if config.Dedupe {
+		domains = dedupeDomains(domains)
+	}
+	return domains
+}
+
+// runChecks checks every domain once, leaving out the skipped ones.
+func runChecks(ctx context.Context, cfgDomains []DomainConfig) []Domain {
+	config := ctx.Value(configKey{}).(*Config)
+	domains := make([]Domain, len(cfgDomains))
+	skipped := make([]bool, len(cfgDomains))
+	parallel(config.checkConcurrency(), len(cfgDomains), func(i int) {
+		cfgDomain := cfgDomains[i]
+		slog.Debug(fmt.Sprintf("checking domain: %s", cfgDomain.ref()))
+
+		start := time.Now()
+		checkCtx := ctx
+		if cfgDomain.discover {
+			var cancel context.CancelFunc
+			checkCtx, cancel = context.WithTimeout(ctx, discoverTimeout)
+			defer cancel()
+		}
+		domain, err := getDomain(checkCtx, cfgDomain)
+		if err != nil && cfgDomain.discover {
+			slog.Debug("port does not serve tls", "domain", cfgDomain.ref(), "error", err.Error())
+			skipped[i] = true
+			return
+		}
+		if err != nil && cfgDomain.AllowUnreachable && isUnreachable(err) {
+			slog.Debug("domain is unreachable", "domain", cfgDomain.ref(), "error", err.Error())
+			skipped[i] = true
+			return
+		}
+		if err != nil {
+			slog.Error("failed to check domain", "domain", cfgDomain.ref(), "error", err.Error())
+			domains[i] = Domain{NameRef: cfgDomain.ref(), Source: config.source(), Labels: cfgDomain.Labels, Status: StatusError, Error: err.Error(), Timings: Timings{Total: time.Since(start)}}
+			return
+		}
+		domain.Timings.Total = time.Since(start)
+		slog.Debug("domain", "domain", domain)
+
+		domains[i] = *domain
+	})
+	checked := []Domain{}
+	for i, domain := range domains {
+		if !skipped[i] {
+			checked = append(checked, domain)
+		}
+	}
+	return checked
+}
+
+// allFailed reports whether there were domains and none could be checked.
+func allFailed(domains []Domain) bool {
+	for _, domain := range domains {
+		if domain.Status != StatusError {
+			return false
+		}
+	}
+	return len(domains) > 0
+}
+
+const defaultRunRetryDelay = 30 * time.Second
+
+func (c Config) runRetryDelay() time.Duration {
+	if c.RunRetryDelay > 0 {
+		return c.RunRetryDelay
+	}
+	return defaultRunRetryDelay
+}
+
+// publish sends the results to the configured exporters. Export failures are
+// logged and never abort the run.
+func publish(ctx context.Context, domains []Domain) {
+	config := ctx.Value(configKey{}).(*Config)
+	if config.OTel.Endpoint != "" {
+		if err := exportOTel(ctx, succeeded(domains)); err != nil {
+			slog.Error("failed to export to opentelemetry", "error", err.Error())
+		}
+	}
+	if config.Kafka.Topic != "" {
+		if err := exportKafka(ctx, config.Kafka, domains); err != nil {
+			slog.Error("failed to publish to kafka", "error", err.Error())
+		}
+	}
+	if config.MinDaysFile != "" {
+		if err := writeMinDays(config.MinDaysFile, domains); err != nil {
+			slog.Error("failed to write min_days_file", "error", err.Error())
 		}
-		summary := fmt.Sprint(strings.Join(summaryLines, "\n"))
-		if *printFlag {
-			fmt.Println(summary)
+	}
+	if config.ReportDir != "" {
+		path, err := writeReport(config.ReportDir, domains)
+		if err != nil {
+			slog.Error("failed to write report", "error", err.Error())
 		} else {
-			subject := "certificate summary"
-			sendEmail(ctx, subject, summary)
+			slog.Debug("wrote report", "path", path)
+			if err := pruneReports(config.ReportDir, config.ReportRetention); err != nil {
+				slog.Error("failed to prune reports", "error", err.Error())
+			}
 		}
 	}
 }
 
-func getDomain(ctx context.Context, domain string) (*Domain, error) {
+// succeeded filters out the domains that could not be checked.
+func succeeded(domains []Domain) []Domain {
+	ok := []Domain{}
+	for _, domain := range domains {
+		if domain.Status != StatusError {
+			ok = append(ok, domain)
+		}
+	}
+	return ok
+}
+
+// expiringBefore filters the domains to the ones whose cert expires before
+// the date.
+func expiringBefore(domains []Domain, date time.Time) []Domain {
+	before := []Domain{}
+	for _, domain := range domains {
+		if domain.Expires < date.Format("2006-01-02") {
+			before = append(before, domain)
+		}
+	}
+	return before
+}
+
+// report sends or prints the results according to the output options.
+func report(ctx context.Context, domains []Domain, opts Options) error {
+	if !opts.ExpireBefore.IsZero() {
+		domains = expiringBefore(domains, opts.ExpireBefore)
+	}
+
+	// print the results, or email them as a summary
 	config := ctx.Value(configKey{}).(*Config)
-	d := &Domain{NameRef: domain}
-	summary := []string{}
+	formatter := formatters[opts.Format]
+	switch f := formatter.(type) {
+	case textFormatter:
+		f.Group = opts.Group
+		f.GroupBy = opts.GroupBy
+		formatter = f
+	case jsonFormatter:
+		f.Raw = opts.Raw
+		formatter = f
+	case csvFormatter:
+		f.Raw = opts.Raw
+		formatter = f
+	}
+
+	// nothing is sent while the maintenance marker file exists
+	maintenance := inMaintenance(config.MaintenanceFile)
+	if maintenance {
+		slog.Warn("maintenance mode is active, skipping notifications", "file", config.MaintenanceFile)
+	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
+	if opts.Print && opts.Output != "" {
+		f, err := os.Create(opts.Output)
+		if err != nil {
+			return err
+		}
+		if err := formatter.Write(f, domains); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if opts.Print {
+		return formatter.Write(os.Stdout, domains)
+	}
+
+	// A supervisor reading the summary from a pipe gets it instead of the
+	// summary email, in maintenance too since the checks still ran
+	if opts.SummaryFile != nil {
+		body, err := summaryBody(config, formatter, domains)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(opts.SummaryFile, body); err != nil {
+			return fmt.Errorf("failed to write summary to %s: %w", opts.SummaryFile.Name(), err)
+		}
+		if !maintenance {
+			saveNotified(ctx, domains, notify(ctx, domains, false))
+		}
+		return nil
 	}
-	conn, err := tls.Dial("tcp", domain+":443", tlsConfig)
+	if maintenance {
+		return nil
+	}
+
+	// per-domain emails are replaced by the summary email when it is requested
+	failed := notify(ctx, domains, !opts.Summary)
+	if !opts.Summary {
+		saveNotified(ctx, domains, failed)
+		return nil
+	}
+	body, err := summaryBody(config, formatter, domains)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	err = sendEmail(ctx, "certificate summary", body)
+	logReceipt(ctx, "email", emailTarget(config.SMTP), domainRefs(domains), err)
+	if err != nil {
+		for _, domain := range domains {
+			failed[domain.NameRef] = true
+		}
+	}
+	saveNotified(ctx, domains, failed)
+	return nil
+}
+
+// summaryBody renders the summary with the summary_template, or with the
+// formatter when there is none.
+func summaryBody(config *Config, formatter Formatter, domains []Domain) (string, error) {
+	if config.SummaryTemplate != "" {
+		rendered, err := renderSummary(config.SummaryTemplate, domains)
+		if err != nil {
+			return "", fmt.Errorf("failed to render summary template: %w", err)
+		}
+		return rendered, nil
+	}
+	var buf bytes.Buffer
+	if err := formatter.Write(&buf, domains); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// saveNotified records in the state file what was notified about, once the
+// notifications have been sent.
+func saveNotified(ctx context.Context, domains []Domain, failed map[string]bool) {
+	config := ctx.Value(configKey{}).(*Config)
+	if config.StateFile == "" {
+		return
+	}
+	state, err := loadState(config.StateFile)
+	if err != nil {
+		slog.Error("failed to load state", "error", err.Error())
+		return
+	}
+	applyNotified(state, domains, failed, config.dedupKey())
+	if err := saveState(config.StateFile, state); err != nil {
+		slog.Error("failed to save state", "error", err.Error())
+	}
+}
+
+func getDomain(ctx context.Context, dc DomainConfig) (*Domain, error) {
+	config := ctx.Value(configKey{}).(*Config)
+	d := &Domain{NameRef: dc.ref(), Source: config.source(), Notifiers: dc.Notifiers, Labels: dc.Labels, RunbookURL: dc.RunbookURL, probeGroup: dc.probeGroup}
+
+	// Local cert files are analyzed as if the certs had been served
+	var state tls.ConnectionState
+	if dc.File != "" {
+		certs, err := loadCertFile(dc.File, dc.Password)
+		if err != nil {
+			return nil, err
+		}
+		state.PeerCertificates = certs
+	} else {
+		host, port := dc.hostPort()
+		d.Port = port
+		dialHost := host
+		if dc.Address != "" {
+			dialHost = dc.Address
+		}
+		tlsConfig := &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+		}
+		if dc.ProbeName != "" {
+			tlsConfig.ServerName = dc.ProbeName
+		}
+		if dc.TLSProfile != "" {
+			profile, ok := config.TLSProfiles[dc.TLSProfile]
+			if !ok {
+				return nil, fmt.Errorf("unknown tls_profile %q", dc.TLSProfile)
+			}
+			if err := profile.apply(tlsConfig); err != nil {
+				return nil, fmt.Errorf("invalid tls_profile %q: %w", dc.TLSProfile, err)
+			}
+			dc.Renegotiate = dc.Renegotiate || profile.Renegotiate
+		}
+		if dc.Renegotiate {
+			tlsConfig.Renegotiation = tls.RenegotiateOnceAsClient
+			tlsConfig.MaxVersion = tls.VersionTLS12
+		}
+		if config.SessionResumption {
+			tlsConfig.ClientSessionCache = sessionCache
+		} else {
+			tlsConfig.SessionTicketsDisabled = true
+		}
+		var negotiate negotiator
+		if dc.StartTLS != "" {
+			negotiate = startTLSNegotiators[dc.StartTLS]
+			if negotiate == nil {
+				return nil, fmt.Errorf("unsupported starttls protocol: %s", dc.StartTLS)
+			}
+		}
+		if dc.HTTPUpgrade.enabled() {
+			if negotiate != nil {
+				return nil, fmt.Errorf("starttls and http_upgrade cannot be combined")
+			}
+			negotiate = negotiateHTTPUpgrade(authority(host, port), dc.HTTPUpgrade)
+		}
+		var conn *tls.Conn
+		var timings Timings
+		var err error
+		if dc.conn != nil {
+			conn, err = handshake(ctx, dc.conn, tlsConfig, negotiate, &timings)
+		} else {
+			conn, timings, err = dialDomain(ctx, dialHost, port, tlsConfig, negotiate)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		// Some relays only accept the session once the client authenticates
+		if dc.StartTLS == "smtp" && dc.SMTPAuth.Username != "" {
+			if err := smtpAuth(conn, dc.SMTPAuth); err != nil {
+				d.Problems = append(d.Problems, fmt.Sprintf("smtp authentication failed: %s", err.Error()))
+			}
+		}
+
+		// A renegotiation replaces the served certs, so the request that
+		// prompts it is sent before the connection state is read
+		if dc.HTTPProbe.enabled() || dc.Renegotiate {
+			status, err := probeHTTP(conn, authority(host, port), dc.HTTPProbe)
+			if err != nil {
+				d.Problems = append(d.Problems, fmt.Sprintf("http probe failed: %s", err.Error()))
+			}
+			d.HTTPStatus = status
+		}
+		// Load balanced names can serve a different cert from each address
+		if dc.CheckAllIPs {
+			fingerprints, problems, err := checkAllIPs(ctx, dialHost, port, tlsConfig, negotiate)
+			if err != nil {
+				d.Problems = append(d.Problems, fmt.Sprintf("failed to check all addresses: %s", err.Error()))
+			}
+			d.Problems = append(d.Problems, problems...)
+			if problem := ipDiscrepancy(fingerprints); problem != "" {
+				d.Problems = append(d.Problems, problem)
+			}
+			d.AddressCerts = fingerprints
+		}
+
+		// Confirm that outdated protocol versions are refused
+		if dc.RejectBelow != "" {
+			problem, err := checkRejectBelow(ctx, dialHost, port, tlsConfig, negotiate, dc.RejectBelow)
+			if err != nil {
+				return nil, err
+			}
+			if problem != "" {
+				d.Problems = append(d.Problems, problem)
+			}
+		}
+
+		d.Timings = timings
+		d.TCPConnectSeconds = timings.Connect.Seconds()
+		d.TLSHandshakeSeconds = timings.Handshake.Seconds()
+		slog.Debug("timings", "domain", dc.Name, "dns", timings.DNS.String(), "connect", timings.Connect.String(), "handshake", timings.Handshake.String())
+		state = conn.ConnectionState()
 	}
-	defer conn.Close()
 
-	cert := conn.ConnectionState().PeerCertificates[0]
+	cert := state.PeerCertificates[0]
+	d.Fingerprint = fingerprint(cert)
+	d.SPKIHash = spkiHash(cert)
+	d.KeyAlgorithm, d.KeyBits = publicKeyDetails(cert)
+	d.Serial = cert.SerialNumber.Text(16)
 	d.CommonName = cert.Subject.CommonName
+	d.Issuer = cert.Issuer.String()
+	d.Chain = chainCerts(state.PeerCertificates)
+	d.IssuerURLs = cert.IssuingCertificateURL
+	d.OCSPServers = cert.OCSPServer
+	d.MustStaple = mustStaple(cert)
 	d.DNSNames = cert.DNSNames
+	for _, ip := range cert.IPAddresses {
+		d.IPNames = append(d.IPNames, ip.String())
+	}
+	d.Issued = cert.NotBefore.Format("2006-01-02")
 	d.Expires = cert.NotAfter.Format("2006-01-02")
+	d.DaysRemaining = int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+	d.ExpiresIn = humanizeDays(d.DaysRemaining)
+	d.LifetimeDays = int(cert.NotAfter.Sub(cert.NotBefore).Hours() / 24)
+	d.ElapsedPercent = elapsedPercent(cert.NotBefore, cert.NotAfter, time.Now())
+	for _, oid := range cert.PolicyIdentifiers {
+		d.PolicyOIDs = append(d.PolicyOIDs, oid.String())
+	}
 
-	// If the cert is within configured days of expiry
-	if isDateWithinDays(ctx, d.Expires, config.Threshold) {
+	// If the cert is within configured days of expiry for its issuer,
+	// flagging it sooner when it expires on a non-working day
+	threshold := issuerThreshold(config.IssuerThresholds, cert.Issuer, config.Threshold)
+	if dc.Threshold != nil {
+		threshold = *dc.Threshold
+	}
+	if config.NonWorkingDays.includes(cert.NotAfter) {
+		d.ExpiresOffDay = true
+		threshold += config.NonWorkingDays.Escalation
+	}
+	if isWithinDays(time.Now(), cert.NotAfter, threshold) {
 		d.IsExpiringSoon = true
 	}
 
-	// build summary
+	d.Status = StatusOK
+	if d.IsExpiringSoon {
+		d.Status = StatusExpiring
+	}
+	if time.Now().After(cert.NotAfter) {
+		d.Status = StatusExpired
+	}
+	d.Severity = severityFor(config.Severity, d.DaysRemaining)
+
+	// If verification is enabled, verify the served chain against the system roots
+	verify := config.Verify
+	if dc.Verify != nil {
+		verify = *dc.Verify
+	}
+	if verify {
+		host, _ := dc.hostPort()
+		if dc.ProbeName != "" {
+			host = dc.ProbeName
+		}
+		chains, err := verifyChain(host, state.PeerCertificates, nil)
+
+		// Clients that follow AIA would still build the chain, so it is
+		// verified with the fetched issuers while flagging the missing ones
+		var unknown x509.UnknownAuthorityError
+		if err != nil && config.FetchIntermediates && errors.As(err, &unknown) {
+			last := state.PeerCertificates[len(state.PeerCertificates)-1]
+			fetched, fetchErr := fetchIssuers(ctx, last)
+			if fetchErr != nil {
+				d.Problems = append(d.Problems, fmt.Sprintf("failed to fetch intermediates via AIA: %s", fetchErr.Error()))
+			}
+			if len(fetched) > 0 {
+				if fetchedChains, fetchedErr := verifyChain(host, state.PeerCertificates, fetched); fetchedErr == nil {
+					chains, err = fetchedChains, nil
+					d.IncompleteChain = true
+					d.Problems = append(d.Problems, fmt.Sprintf("server did not send the intermediates needed to build a chain, verified with %d fetched via AIA", len(fetched)))
+				}
+			}
+		}
+		if err != nil {
+			d.VerifyError = err.Error()
+			d.Problems = append(d.Problems, fmt.Sprintf("verification failed: %s", err.Error()))
+		} else {
+			d.Verified = true
+			d.VerifiedChains = chains
+		}
+	}
+
+	// Check that the server sent every intermediate, since not all clients
+	// fetch missing ones
+	if config.CheckChain && !d.IncompleteChain {
+		if problem := checkChain(d, state.PeerCertificates, config.IntermediatesFile); problem != "" {
+			d.Problems = append(d.Problems, problem)
+		}
+	}
+	if config.CheckChainOrder {
+		if problem := checkChainOrder(d, state.PeerCertificates); problem != "" {
+			d.Problems = append(d.Problems, problem)
+		}
+	}
+
+	// Check the stapled OCSP response, only flagging it when required or when
+	// the cert is Must-Staple, since clients then reject a missing staple
+	if dc.File == "" {
+		problem := checkStaple(d, state)
+		if problem != "" && d.MustStaple {
+			d.Problems = append(d.Problems, fmt.Sprintf("must-staple cert: %s", problem))
+		} else if problem != "" && config.RequireOCSPStaple {
+			d.Problems = append(d.Problems, problem)
+		}
+	}
+
+	// Look for the cert, and any unexpected ones, in the CT logs
+	if dc.CTCheck {
+		host, _ := dc.hostPort()
+		problems, err := checkCT(ctx, config.CT, host, d.Serial, dc.CTKnownSerials)
+		if err != nil {
+			d.Problems = append(d.Problems, fmt.Sprintf("ct log check failed: %s", err.Error()))
+		}
+		d.Problems = append(d.Problems, problems...)
+	}
+
+	// If the cert expires before the required date
+	if !config.RequireValidUntil.IsZero() && cert.NotAfter.Before(config.RequireValidUntil) {
+		d.Problems = append(d.Problems, fmt.Sprintf("expires before the required date of %s", config.RequireValidUntil.Format("2006-01-02")))
+	}
+
+	// If the cert expires during the change freeze
+	if config.Freeze.covers(time.Now(), cert.NotAfter) {
+		d.Problems = append(d.Problems, fmt.Sprintf("expires on %s during the change freeze ending %s, renew it before the freeze", d.Expires, config.Freeze.End.Format("2006-01-02")))
+	}
+
+	// If the cert was issued with a shorter or longer lifetime than configured
+	if config.MinLifetime > 0 && d.LifetimeDays < config.MinLifetime {
+		d.Problems = append(d.Problems, fmt.Sprintf("lifetime of %d days is below the minimum of %d days", d.LifetimeDays, config.MinLifetime))
+	}
+	if config.MaxLifetime > 0 && d.LifetimeDays > config.MaxLifetime {
+		d.Problems = append(d.Problems, fmt.Sprintf("lifetime of %d days is above the maximum of %d days", d.LifetimeDays, config.MaxLifetime))
+	}
+
+	// If the cert is missing the expected certificate policy
+	if dc.ExpectedPolicyOID != "" && !slices.Contains(d.PolicyOIDs, dc.ExpectedPolicyOID) {
+		d.Problems = append(d.Problems, fmt.Sprintf("expected policy OID %s not present", dc.ExpectedPolicyOID))
+	}
+
+	// If the cert is not issued for the expected usage, such as server auth
+	expectedEKU := config.ExpectedEKU
+	if dc.ExpectedEKU != nil {
+		expectedEKU = dc.ExpectedEKU
+	}
+	if len(expectedEKU) > 0 {
+		problem, err := checkEKU(cert, expectedEKU)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			d.Problems = append(d.Problems, problem)
+		}
+	}
+
+	// If the public key is weaker than the crypto policy allows
+	if config.CryptoPolicy.enabled() {
+		if problem := config.CryptoPolicy.check(d.KeyAlgorithm, d.KeyBits); problem != "" {
+			d.Problems = append(d.Problems, problem)
+		}
+	}
+
+	// If a wildcard name covers more than the policy allows
+	if config.WildcardMinDepth > 0 {
+		d.Problems = append(d.Problems, broadWildcards(d.DNSNames, config.WildcardMinDepth)...)
+	}
+
+	// If the served public key is not the pinned one
+	if dc.SPKIPin != "" && d.SPKIHash != dc.SPKIPin {
+		d.Problems = append(d.Problems, fmt.Sprintf("public key %s does not match the pinned key %s", d.SPKIHash, dc.SPKIPin))
+	}
+
+	// If the served cert is not the canonical one in Vault
+	if dc.Vault.Path != "" {
+		problem, err := checkVault(ctx, config.Vault, dc.Vault, d.Fingerprint)
+		if err != nil {
+			d.Problems = append(d.Problems, fmt.Sprintf("vault check failed: %s", err.Error()))
+		} else if problem != "" {
+			d.Problems = append(d.Problems, problem)
+		}
+	}
+
+	// If the cert does not cover the name it was requested for
+	if dc.ProbeName != "" {
+		if err := cert.VerifyHostname(dc.ProbeName); err != nil {
+			d.Problems = append(d.Problems, fmt.Sprintf("does not cover the probe name %s", dc.ProbeName))
+		}
+	}
+
+	// If the served cert is not the one expected, such as by an sni_map
+	if dc.ExpectedFingerprint != "" && normalizeFingerprint(dc.ExpectedFingerprint) != d.Fingerprint {
+		d.Problems = append(d.Problems, fmt.Sprintf("served cert %s, expected %s", d.Fingerprint, normalizeFingerprint(dc.ExpectedFingerprint)))
+	}
+	if dc.ExpectedCommonName != "" && d.CommonName != dc.ExpectedCommonName {
+		d.Problems = append(d.Problems, fmt.Sprintf("served common name %q, expected %q", d.CommonName, dc.ExpectedCommonName))
+	}
+
+	// If the cert does not cover exactly the expected names
+	if len(dc.ExactNames) > 0 && !sameNames(dc.ExactNames, d.DNSNames) {
+		missing, extra := diffNames(dc.ExactNames, d.DNSNames)
+		d.Problems = append(d.Problems, fmt.Sprintf("DNS names differ from the expected names, missing: [%s], unexpected: [%s]", strings.Join(missing, ", "), strings.Join(extra, ", ")))
+	}
+
+	d.Summary = summarize(d)
+
+	return d, nil
+}
+
+// summarize builds the human readable summary of a domain.
+func summarize(d *Domain) string {
+	summary := []string{}
 	summary = append(summary, d.CommonName)
 	summary = append(summary, fmt.Sprintf("  Expiring Soon: %v", d.IsExpiringSoon))
-	summary = append(summary, fmt.Sprintf("  Expires:       %s", d.Expires))
+	summary = append(summary, fmt.Sprintf("  Severity:      %s", d.Severity))
+	if d.ExpiresOffDay {
+		summary = append(summary, fmt.Sprintf("  Expires:       %s (%s, non-working day)", d.Expires, d.ExpiresIn))
+	} else {
+		summary = append(summary, fmt.Sprintf("  Expires:       %s (%s)", d.Expires, d.ExpiresIn))
+	}
+	summary = append(summary, fmt.Sprintf("  Days Left:     %d", d.DaysRemaining))
+	if d.Trend != "" {
+		summary = append(summary, fmt.Sprintf("  Since Last:    %s", d.Trend))
+	}
+	if d.Issuer != "" {
+		summary = append(summary, fmt.Sprintf("  Issuer:        %s", d.Issuer))
+	}
+	if d.KeyAlgorithm != "" {
+		summary = append(summary, fmt.Sprintf("  Key:           %s %d bits", d.KeyAlgorithm, d.KeyBits))
+	}
+	if d.MustStaple {
+		summary = append(summary, "  Must-Staple:   true")
+	}
+	if d.Source != "" {
+		summary = append(summary, fmt.Sprintf("  Source:        %s", d.Source))
+	}
 	summary = append(summary, "  DNS Alt Names:")
 	for _, dnsName := range d.DNSNames {
 		summary = append(summary, fmt.Sprintf("    %s", dnsName))
 	}
-	d.Summary = strings.Join(summary, "\n")
+	if len(d.IPNames) > 0 {
+		summary = append(summary, "  IP Alt Names:")
+		for _, ip := range d.IPNames {
+			summary = append(summary, fmt.Sprintf("    %s", ip))
+		}
+	}
+	if len(d.IssuerURLs) > 0 {
+		summary = append(summary, "  CA Issuers:")
+		for _, url := range d.IssuerURLs {
+			summary = append(summary, fmt.Sprintf("    %s", url))
+		}
+	}
+	if len(d.OCSPServers) > 0 {
+		summary = append(summary, "  OCSP Servers:")
+		for _, url := range d.OCSPServers {
+			summary = append(summary, fmt.Sprintf("    %s", url))
+		}
+	}
+	if len(d.Hostnames) > 1 {
+		summary = append(summary, "  Served To:")
+		for _, hostname := range d.Hostnames {
+			summary = append(summary, fmt.Sprintf("    %s", hostname))
+		}
+	}
+	if d.Verified || d.VerifyError != "" {
+		summary = append(summary, fmt.Sprintf("  Verified:      %v", d.Verified))
+		for _, chain := range d.VerifiedChains {
+			summary = append(summary, fmt.Sprintf("    %s", chain))
+		}
+	}
+	if len(d.Problems) > 0 {
+		summary = append(summary, "  Problems:")
+		for _, problem := range d.Problems {
+			summary = append(summary, fmt.Sprintf("    %s", problem))
+		}
+	}
+	return strings.Join(summary, "\n")
+}
 
-	return d, nil
+// authority is the host, with the port unless it is the default, as sent in
+// HTTP Host headers.
+func authority(host string, port string) string {
+	if port == defaultPort {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// issuerThreshold returns the threshold for certs from the issuer, matched by
+// common name and then by organization, or fallback when none is set.
+func issuerThreshold(thresholds map[string]int, issuer pkix.Name, fallback int) int {
+	if t, ok := thresholds[issuer.CommonName]; ok {
+		return t
+	}
+	for _, org := range issuer.Organization {
+		if t, ok := thresholds[org]; ok {
+			return t
+		}
+	}
+	return fallback
+}
+
+// elapsedPercent returns how much of the validity window has passed at now,
+// between 0 and 100.
+func elapsedPercent(notBefore time.Time, notAfter time.Time, now time.Time) float64 {
+	lifetime := notAfter.Sub(notBefore)
+	if lifetime <= 0 {
+		return 100
+	}
+	percent := float64(now.Sub(notBefore)) / float64(lifetime) * 100
+	return math.Max(0, math.Min(100, percent))
+}
+
+// humanizeDays describes days remaining relative to now, in weeks once it
+// is at least two weeks and in days below that.
+func humanizeDays(days int) string {
+	switch {
+	case days == 0:
+		return "in less than a day"
+	case days > 0:
+		return "in " + pluralize(days)
+	default:
+		return "expired " + pluralize(-days) + " ago"
+	}
+}
+
+func pluralize(days int) string {
+	switch {
+	case days >= 14:
+		return fmt.Sprintf("%d weeks", days/7)
+	case days == 1:
+		return "1 day"
+	default:
+		return fmt.Sprintf("%d days", days)
+	}
 }
 
-func sendEmail(ctx context.Context, subject string, contents string) {
+// fingerprint returns the hex encoded SHA-256 of the certificate.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// spkiHash returns the base64 encoded SHA-256 of the cert's public key, the
+// same pin format used by HPKP.
+func spkiHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// dedupeDomains collapses domains that were served the identical cert into
+// a single result listing every hostname that served it.
+func dedupeDomains(domains []Domain) []Domain {
+	return dedupeBy(domains, func(d Domain) string { return d.Fingerprint })
+}
+
+// dedupeProbeNames collapses the probe_names of one entry that were served
+// the identical cert with the same problems.
+func dedupeProbeNames(domains []Domain) []Domain {
+	return dedupeBy(domains, func(d Domain) string {
+		if d.probeGroup == "" {
+			return ""
+		}
+		return d.probeGroup + " " + d.Fingerprint + " " + strings.Join(d.Problems, "\n")
+	})
+}
+
+// dedupeBy collapses the domains with the same key into the first of them,
+// listing the hostnames of all. Domains with an empty key are kept as is.
+func dedupeBy(domains []Domain, key func(Domain) string) []Domain {
+	deduped := []Domain{}
+	seen := map[string]int{}
+	for _, domain := range domains {
+		k := key(domain)
+		if domain.Status == StatusError || k == "" {
+			deduped = append(deduped, domain)
+			continue
+		}
+		if len(domain.Hostnames) == 0 {
+			domain.Hostnames = []string{domain.NameRef}
+		}
+		if i, ok := seen[k]; ok {
+			deduped[i].Hostnames = append(deduped[i].Hostnames, domain.Hostnames...)
+			deduped[i].Summary = summarize(&deduped[i])
+			continue
+		}
+		seen[k] = len(deduped)
+		deduped = append(deduped, domain)
+	}
+	return deduped
+}
+
+// dialDomain resolves the host, connects to the first reachable address and
+// performs the TLS handshake, timing each phase along the way. If negotiate
+// is set it is run on the plain connection before the handshake.
+func dialDomain(ctx context.Context, host string, port string, tlsConfig *tls.Config, negotiate negotiator) (*tls.Conn, Timings, error) {
+	var timings Timings
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	timings.DNS = time.Since(start)
+	if err != nil {
+		return nil, timings, err
+	}
+
+	start = time.Now()
+	dialer := &net.Dialer{}
+	var rawConn net.Conn
+	netnsErr := withNetns(ctx.Value(configKey{}).(*Config).NetNS, func() error {
+		for _, addr := range addrs {
+			rawConn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, port))
+			if err == nil {
+				break
+			}
+		}
+		return nil
+	})
+	if netnsErr != nil {
+		return nil, timings, netnsErr
+	}
+	timings.Connect = time.Since(start)
+	if err != nil {
+		return nil, timings, err
+	}
+
+	conn, err := handshake(ctx, rawConn, tlsConfig, negotiate, &timings)
+	if err != nil {
+		return nil, timings, err
+	}
+	return conn, timings, nil
+}
+
+// handshake runs the optional plaintext negotiation and the TLS handshake
+// over a connected socket, closing it on failure.
+func handshake(ctx context.Context, rawConn net.Conn, tlsConfig *tls.Config, negotiate negotiator, timings *Timings) (*tls.Conn, error) {
+	// Protocols that upgrade to TLS have to be spoken in plaintext first
+	if negotiate != nil {
+		rawConn.SetDeadline(time.Now().Add(negotiateTimeout))
+		if err := negotiate(rawConn); err != nil {
+			rawConn.Close()
+			return nil, fmt.Errorf("starttls negotiation failed: %w", err)
+		}
+		rawConn.SetDeadline(time.Time{})
+	}
+
+	start := time.Now()
+	conn := tls.Client(rawConn, tlsConfig)
+	err := conn.HandshakeContext(ctx)
+	timings.Handshake = time.Since(start)
+	if err != nil {
+		rawConn.Close()
+		if isHandshakeReset(err) {
+			return nil, fmt.Errorf("%w (%w)", errHandshakeReset, err)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// errHandshakeReset replaces the bare EOF and reset errors of servers that
+// accept the connection but drop it before the handshake completes.
+var errHandshakeReset = errors.New("connection reset during TLS handshake")
+
+func isHandshakeReset(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// verifyChain verifies the leaf against the system roots, using the rest of
+// the served certs and any fetched ones as intermediates. Each verified
+// chain is returned as the subject names from leaf to root.
+func verifyChain(host string, certs []*x509.Certificate, fetched []*x509.Certificate) ([]string, error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	for _, cert := range fetched {
+		intermediates.AddCert(cert)
+	}
+	verifiedChains, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chains := []string{}
+	for _, chain := range verifiedChains {
+		names := []string{}
+		for _, cert := range chain {
+			names = append(names, cert.Subject.CommonName)
+		}
+		chains = append(chains, strings.Join(names, " -> "))
+	}
+	return chains, nil
+}
+
+func newEmailDialer(config SMTPConfig) *gomail.Dialer {
+	d := gomail.NewDialer(config.Server, config.Port, "", "")
+	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	d.Timeout = config.Timeout
+	if d.Timeout == 0 {
+		d.Timeout = defaultSMTPTimeout
+	}
+	return d
+}
+
+func sendEmail(ctx context.Context, subject string, contents string) error {
 	config := ctx.Value(configKey{}).(*Config)
 	m := gomail.NewMessage()
 	m.SetHeader("From", config.SMTP.From)
 	m.SetHeader("To", config.SMTP.To...)
 	m.SetHeader("Subject", subject)
+	if source := config.source(); source != "" {
+		m.SetHeader("X-Cert-Monitor-Source", source)
+	}
+	if config.SMTP.MessageIDDomain != "" {
+		m.SetHeader("Message-ID", messageID(config.SMTP.MessageIDDomain))
+	}
+	contents = withBanner(ctx, contents)
 	m.SetBody("text/plain", contents)
 	slog.Debug("sending email", "subject", subject, "contents", contents)
-	d := gomail.NewDialer(config.SMTP.Server, config.SMTP.Port, "", "")
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	d := newEmailDialer(config.SMTP)
 
+	throttleFor("email").wait("email", config.SMTP.MinInterval)
 	if err := d.DialAndSend(m); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			slog.Error("failed to send email", "error", "timed out", "timeout", d.Timeout.String())
+			return err
+		}
 		slog.Error("failed to send email", "error", err.Error())
+		return err
 	}
+	return nil
 }
 
-func isDateWithinDays(ctx context.Context, targetDate string, days int) bool {
-	today := time.Now()
+// messageID returns a unique Message-ID in the given domain.
+func messageID(domain string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
 
-	expires, err := time.Parse("2006-01-02", targetDate)
-	if err != nil {
-		slog.Error(fmt.Sprintf("failed to parse expiration date: %s\n", err.Error()))
-	}
+// isWithinDays reports whether a cert expiring at notAfter expires within
+// days of now. It compares the exact expiry time rather than its date, so
+// with 0 days only certs that have already expired are within, the same
+// ones StatusExpired is set for, and a cert expiring later today is not.
+func isWithinDays(now time.Time, notAfter time.Time, days int) bool {
+	return now.AddDate(0, 0, days).After(notAfter)
+}
 
-	// is the cert within days of expiring?
-	return today.AddDate(0, 0, days).After(expires)
+// applyEnv merges settings from the environment into the config.
+// CERT_MONITOR_DOMAINS is a comma separated list of domains, optionally with
+// ports, added to the domains from the file. CERT_MONITOR_THRESHOLD overrides
+// the threshold from the file.
+func applyEnv(config *Config) error {
+	if domains, found := os.LookupEnv("CERT_MONITOR_DOMAINS"); found {
+		for _, name := range strings.Split(domains, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				config.Domains = append(config.Domains, DomainConfig{Name: name})
+			}
+		}
+	}
+	if threshold, found := os.LookupEnv("CERT_MONITOR_THRESHOLD"); found {
+		days, err := strconv.Atoi(threshold)
+		if err != nil {
+			return fmt.Errorf("invalid CERT_MONITOR_THRESHOLD: %s", threshold)
+		}
+		config.Threshold = days
+	}
+	return nil
 }
 
 func getConfigPath(configFlag string) (string, error) {
@@ -217,3 +1885,13 @@ func getConfigPath(configFlag string) (string, error) {
 
 	return "", fmt.Errorf("config file not found")
 }
+
+// isUnreachable reports whether err means the server was down or could not
+// be reached, rather than reached and misbehaving.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
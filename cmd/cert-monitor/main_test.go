@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// dropServer accepts one connection and closes it in the middle of the
+// handshake. It reads the whole ClientHello record and closes cleanly, so the
+// client sees EOF, or with reset sets linger 0 after reading its header so
+// the client sees a reset.
+func dropServer(t *testing.T, reset bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(conn, header); err == nil && !reset {
+			io.CopyN(io.Discard, conn, int64(header[3])<<8|int64(header[4]))
+		}
+		if reset {
+			conn.(*net.TCPConn).SetLinger(0)
+		}
+		conn.Close()
+	}()
+	return ln.Addr().String()
+}
+
+func TestHandshakeReset(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		reset bool
+		cause error
+	}{
+		{"eof", false, io.EOF},
+		{"rst", true, syscall.ECONNRESET},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := dropServer(t, tc.reset)
+			rawConn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = handshake(ctx, rawConn, &tls.Config{ServerName: "example.com"}, nil, &Timings{})
+			if !errors.Is(err, errHandshakeReset) {
+				t.Fatalf("handshake error = %v, want %v", err, errHandshakeReset)
+			}
+			if !errors.Is(err, tc.cause) {
+				t.Fatalf("handshake error = %v, want it to wrap %v", err, tc.cause)
+			}
+		})
+	}
+}
+
+func TestIsWithinDays(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name     string
+		days     int
+		notAfter time.Time
+		want     bool
+	}{
+		{"0 days, expired", 0, now.Add(-time.Minute), true},
+		{"0 days, expires later today", 0, now.Add(6 * time.Hour), false},
+		{"0 days, expires now", 0, now, false},
+		{"1 day, expired", 1, now.Add(-time.Minute), true},
+		{"1 day, expires later today", 1, now.Add(6 * time.Hour), true},
+		{"1 day, expires just before a day from now", 1, now.AddDate(0, 0, 1).Add(-time.Minute), true},
+		{"1 day, expires a day from now", 1, now.AddDate(0, 0, 1), false},
+		{"1 day, expires just over a day from now", 1, now.AddDate(0, 0, 1).Add(time.Minute), false},
+		{"30 days, expires just inside the window", 30, now.AddDate(0, 0, 30).Add(-time.Minute), true},
+		{"30 days, expires at the edge of the window", 30, now.AddDate(0, 0, 30), false},
+		{"30 days, expires just outside the window", 30, now.AddDate(0, 0, 30).Add(time.Minute), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isWithinDays(now, tc.notAfter, tc.days); got != tc.want {
+				t.Errorf("isWithinDays(%s, %s, %d) = %v, want %v", now, tc.notAfter, tc.days, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyState(t *testing.T) {
+	expiring := func(days int, severity Severity) Domain {
+		return Domain{
+			NameRef:        "example.com",
+			CommonName:     "example.com",
+			DNSNames:       []string{"example.com", "www.example.com"},
+			Issuer:         "R3",
+			DaysRemaining:  days,
+			IsExpiringSoon: true,
+			Status:         StatusExpiring,
+			Severity:       severity,
+		}
+	}
+	expired := func(days int) Domain {
+		d := expiring(days, SeverityCritical)
+		d.Status = StatusExpired
+		return d
+	}
+	healthy := func(days int) Domain {
+		d := expiring(days, SeverityOK)
+		d.IsExpiringSoon = false
+		d.Status = StatusOK
+		return d
+	}
+	with := func(d Domain, change func(*Domain)) Domain {
+		change(&d)
+		return d
+	}
+
+	for _, tc := range []struct {
+		name        string
+		first       Domain
+		second      Domain
+		notifyDelta int
+		trend       bool
+		dedupKey    string
+		// failFirst and failSecond fail the notification sent on that pass.
+		failFirst    bool
+		failSecond   bool
+		wantQuiet    bool
+		wantResolved bool
+		wantTrend    string
+		wantProblems []string
+		// wantNotified is what the second pass leaves notified, under every
+		// hostname of the domain.
+		wantNotifiedStatus Status
+		wantNotifiedDays   int
+	}{
+		{
+			name:   "quiet within notify_delta",
+			first:  expiring(20, SeverityWarning),
+			second: expiring(18, SeverityWarning), notifyDelta: 5,
+			wantQuiet: true, wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 20,
+		},
+		{
+			name:   "notified again once past notify_delta",
+			first:  expiring(20, SeverityWarning),
+			second: expiring(15, SeverityWarning), notifyDelta: 5,
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 15,
+		},
+		{
+			name:               "notified every run without notify_delta",
+			first:              expiring(20, SeverityWarning),
+			second:             expiring(19, SeverityWarning),
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 19,
+		},
+		{
+			name:   "notified again when the status changes",
+			first:  expiring(1, SeverityCritical),
+			second: expired(-1), notifyDelta: 5,
+			wantNotifiedStatus: StatusExpired, wantNotifiedDays: -1,
+		},
+		{
+			name:   "notified again when the severity changes",
+			first:  expiring(8, SeverityWarning),
+			second: expiring(6, SeverityCritical), notifyDelta: 5,
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 6,
+		},
+		{
+			name:   "quiet under the same dedup_key",
+			first:  expiring(20, SeverityWarning),
+			second: expiring(18, SeverityWarning), notifyDelta: 5, dedupKey: "{{.Issuer}}",
+			wantQuiet: true, wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 20,
+		},
+		{
+			name:   "notified again when the dedup_key changes",
+			first:  expiring(20, SeverityWarning),
+			second: with(expiring(18, SeverityWarning), func(d *Domain) { d.Issuer = "E1" }), notifyDelta: 5, dedupKey: "{{.Issuer}}",
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 18,
+		},
+		{
+			name:   "retried after a failed notification",
+			first:  expiring(20, SeverityWarning),
+			second: expiring(18, SeverityWarning), notifyDelta: 5, failFirst: true,
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 18,
+		},
+		{
+			name:   "kept as last notified after a failed notification",
+			first:  expiring(20, SeverityWarning),
+			second: expiring(15, SeverityWarning), notifyDelta: 5, failSecond: true,
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 20,
+		},
+		{
+			name:         "resolved once renewed",
+			first:        expiring(20, SeverityWarning),
+			second:       healthy(89),
+			wantResolved: true,
+		},
+		{
+			name:   "not resolved when never notified",
+			first:  healthy(60),
+			second: healthy(59),
+		},
+		{
+			name:   "trend of dropping days",
+			first:  expiring(20, SeverityWarning),
+			second: expiring(18, SeverityWarning), trend: true,
+			wantTrend:          "days remaining dropped from 20 to 18",
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 18,
+		},
+		{
+			name:   "trend of a status change",
+			first:  expiring(1, SeverityCritical),
+			second: expired(-1), trend: true,
+			wantTrend:          "days remaining dropped from 1 to -1, status changed from EXPIRING SOON to EXPIRED",
+			wantNotifiedStatus: StatusExpired, wantNotifiedDays: -1,
+		},
+		{
+			name:         "trend of a renewal",
+			first:        expiring(20, SeverityWarning),
+			second:       healthy(89),
+			trend:        true,
+			wantResolved: true,
+			wantTrend:    "days remaining rose from 20 to 89, status changed from EXPIRING SOON to OK",
+		},
+		{
+			name:   "common name changed",
+			first:  healthy(60),
+			second: with(healthy(59), func(d *Domain) { d.CommonName = "other.example.com" }), notifyDelta: 5,
+			wantProblems:       []string{"common name changed from example.com to other.example.com"},
+			wantNotifiedStatus: StatusOK, wantNotifiedDays: 59,
+		},
+		{
+			name:   "common name change is never quiet",
+			first:  expiring(20, SeverityWarning),
+			second: with(expiring(18, SeverityWarning), func(d *Domain) { d.CommonName = "other.example.com" }), notifyDelta: 5,
+			wantProblems:       []string{"common name changed from example.com to other.example.com"},
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 18,
+		},
+		{
+			name:               "DNS names changed",
+			first:              healthy(60),
+			second:             with(healthy(59), func(d *Domain) { d.DNSNames = []string{"example.com"} }),
+			wantProblems:       []string{"DNS names changed from example.com, www.example.com to example.com"},
+			wantNotifiedStatus: StatusOK, wantNotifiedDays: 59,
+		},
+		{
+			name:        "DNS names reordered",
+			first:       expiring(20, SeverityWarning),
+			second:      with(expiring(18, SeverityWarning), func(d *Domain) { d.DNSNames = []string{"www.example.com", "example.com"} }),
+			notifyDelta: 5,
+			wantQuiet:   true, wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 20,
+		},
+		{
+			name: "notified under every hostname",
+			first: with(expiring(20, SeverityWarning), func(d *Domain) {
+				d.Hostnames = []string{"example.com", "example.org"}
+			}),
+			second: with(expiring(18, SeverityWarning), func(d *Domain) {
+				d.Hostnames = []string{"example.com", "example.org", "example.net"}
+			}),
+			wantNotifiedStatus: StatusExpiring, wantNotifiedDays: 18,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &State{Domains: map[string]DomainState{}}
+			dedupKey := Config{DedupKey: tc.dedupKey}.dedupKey()
+			pass := func(d Domain, failed bool) Domain {
+				domains := []Domain{d}
+				applyState(state, domains, tc.notifyDelta, tc.trend, dedupKey)
+				applyNotified(state, domains, map[string]bool{d.NameRef: failed}, dedupKey)
+				return domains[0]
+			}
+
+			first := pass(tc.first, tc.failFirst)
+			if first.Quiet || first.Resolved || len(first.Problems) > 0 {
+				t.Fatalf("first pass: quiet %v, resolved %v, problems %q, want none", first.Quiet, first.Resolved, first.Problems)
+			}
+			if tc.trend && first.Trend != "first observation" {
+				t.Errorf("first pass: trend %q, want %q", first.Trend, "first observation")
+			}
+
+			second := pass(tc.second, tc.failSecond)
+			if second.Quiet != tc.wantQuiet {
+				t.Errorf("quiet %v, want %v", second.Quiet, tc.wantQuiet)
+			}
+			if second.Resolved != tc.wantResolved {
+				t.Errorf("resolved %v, want %v", second.Resolved, tc.wantResolved)
+			}
+			if second.Trend != tc.wantTrend {
+				t.Errorf("trend %q, want %q", second.Trend, tc.wantTrend)
+			}
+			if !slices.Equal(second.Problems, tc.wantProblems) {
+				t.Errorf("problems %q, want %q", second.Problems, tc.wantProblems)
+			}
+
+			refs := tc.second.Hostnames
+			if len(refs) == 0 {
+				refs = []string{tc.second.NameRef}
+			}
+			for _, ref := range refs {
+				s := state.Domains[ref]
+				if s.NotifiedStatus != tc.wantNotifiedStatus || s.NotifiedDays != tc.wantNotifiedDays {
+					t.Errorf("%s notified as %q with %d days, want %q with %d days", ref, s.NotifiedStatus, s.NotifiedDays, tc.wantNotifiedStatus, tc.wantNotifiedDays)
+				}
+			}
+			if s := state.Domains[tc.second.NameRef]; s.Status != tc.second.Status || s.Days != tc.second.DaysRemaining || s.Error != "" {
+				t.Errorf("state %q with %d days, error %q, want %q with %d days", s.Status, s.Days, s.Error, tc.second.Status, tc.second.DaysRemaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackSchemaVersion is raised whenever a key of msgpackRun or
+// msgpackDomain changes meaning or is removed. New keys may be added without
+// raising it, so consumers should ignore keys they do not know.
+const msgpackSchemaVersion = 1
+
+// msgpackRun is the single msgpack map written for a run.
+type msgpackRun struct {
+	Version   int             `msgpack:"version"`
+	Generated string          `msgpack:"generated"`
+	Domains   []msgpackDomain `msgpack:"domains"`
+}
+
+// msgpackDomain is one domain of a run. The keys are part of the documented
+// schema, so they are stable unlike the Domain field names.
+type msgpackDomain struct {
+	Domain        string            `msgpack:"domain"`
+	Source        string            `msgpack:"source,omitempty"`
+	CommonName    string            `msgpack:"common_name,omitempty"`
+	DNSNames      []string          `msgpack:"dns_names,omitempty"`
+	Fingerprint   string            `msgpack:"fingerprint,omitempty"`
+	Serial        string            `msgpack:"serial,omitempty"`
+	Issuer        string            `msgpack:"issuer,omitempty"`
+	Issued        string            `msgpack:"issued,omitempty"`
+	Expires       string            `msgpack:"expires,omitempty"`
+	DaysRemaining int               `msgpack:"days_remaining"`
+	LifetimeDays  int               `msgpack:"lifetime_days,omitempty"`
+	Status        string            `msgpack:"status"`
+	Severity      string            `msgpack:"severity,omitempty"`
+	Verified      bool              `msgpack:"verified"`
+	Problems      []string          `msgpack:"problems,omitempty"`
+	Error         string            `msgpack:"error,omitempty"`
+	Labels        map[string]string `msgpack:"labels,omitempty"`
+	TotalSeconds  float64           `msgpack:"total_seconds"`
+}
+
+// msgpackFormatter writes the whole run as one msgpack map, for shipping
+// results to a collector more compactly than json.
+type msgpackFormatter struct{}
+
+func (msgpackFormatter) Write(w io.Writer, domains []Domain) error {
+	run := msgpackRun{
+		Version:   msgpackSchemaVersion,
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Domains:   []msgpackDomain{},
+	}
+	for _, d := range domains {
+		run.Domains = append(run.Domains, msgpackDomain{
+			Domain:        d.NameRef,
+			Source:        d.Source,
+			CommonName:    d.CommonName,
+			DNSNames:      d.DNSNames,
+			Fingerprint:   d.Fingerprint,
+			Serial:        d.Serial,
+			Issuer:        d.Issuer,
+			Issued:        d.Issued,
+			Expires:       d.Expires,
+			DaysRemaining: d.DaysRemaining,
+			LifetimeDays:  d.LifetimeDays,
+			Status:        string(d.Status),
+			Severity:      string(d.Severity),
+			Verified:      d.Verified,
+			Problems:      d.Problems,
+			Error:         d.Error,
+			Labels:        d.Labels,
+			TotalSeconds:  d.Timings.Total.Seconds(),
+		})
+	}
+	if err := msgpack.NewEncoder(w).Encode(&run); err != nil {
+		return fmt.Errorf("failed to encode results: %w", err)
+	}
+	return nil
+}
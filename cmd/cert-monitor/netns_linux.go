@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// withNetns runs fn on a thread switched into the network namespace at path,
+// so sockets fn creates belong to that namespace and keep using its routing
+// after the thread switches back. An empty path runs fn as is.
+//
+// fn runs on a goroutine of its own, so that if the thread cannot be
+// switched back it is left locked and exits with that goroutine instead of
+// running anything else in the wrong namespace.
+func withNetns(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		restored, err := inNetns(path, fn)
+		if restored {
+			runtime.UnlockOSThread()
+		}
+		done <- err
+	}()
+	return <-done
+}
+
+// inNetns switches the locked thread into the namespace at path, runs fn and
+// switches back, reporting whether the thread is back in its own namespace.
+func inNetns(path string, fn func() error) (bool, error) {
+	// The thread is locked before its namespace is saved, so the one saved
+	// is the one it is switched back to
+	current, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		return true, fmt.Errorf("failed to open current network namespace: %w", err)
+	}
+	defer current.Close()
+	target, err := os.Open(path)
+	if err != nil {
+		return true, fmt.Errorf("failed to open network namespace: %w", err)
+	}
+	defer target.Close()
+
+	if err := setns(target); err != nil {
+		return true, fmt.Errorf("failed to enter network namespace %s: %w", path, err)
+	}
+	fnErr := fn()
+	if err := setns(current); err != nil {
+		return false, fmt.Errorf("failed to leave network namespace %s: %w", path, err)
+	}
+	return true, fnErr
+}
+
+func setns(f *os.File) error {
+	return unix.Setns(int(f.Fd()), unix.CLONE_NEWNET)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// withNetns runs fn. Network namespaces only exist on Linux, so a path is an
+// error elsewhere.
+func withNetns(path string, fn func() error) error {
+	if path != "" {
+		return fmt.Errorf("network namespaces are only supported on linux")
+	}
+	return fn()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+)
+
+// Notifier is an alerting channel that is given the results of every run and
+// decides for itself which domains to alert on. Check confirms the notifier
+// is configured correctly and reachable without sending anything.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, domains []Domain) error
+	Check(ctx context.Context) error
+}
+
+// notifierNames are the names domains and the config can route alerts to.
+var notifierNames = []string{"email", "github", "statuspage", "slack", "webhook", "exec"}
+
+// configuredNotifiers returns the notifiers enabled in the config, leaving
+// out email when it is not wanted.
+func configuredNotifiers(ctx context.Context, email bool) []Notifier {
+	config := ctx.Value(configKey{}).(*Config)
+	notifiers := []Notifier{}
+	if email {
+		notifiers = append(notifiers, emailNotifier{})
+	}
+	if config.GitHub.Repo != "" {
+		notifiers = append(notifiers, newGitHubNotifier(config.GitHub))
+	}
+	if config.Statuspage.ComponentID != "" {
+		notifiers = append(notifiers, newStatuspageNotifier(config.Statuspage))
+	}
+	if config.Slack.WebhookURL != "" {
+		notifiers = append(notifiers, newSlackNotifier(config.Slack))
+	}
+	if config.Webhook.URL != "" {
+		notifiers = append(notifiers, newWebhookNotifier(config.Webhook))
+	}
+	if config.Exec.Command != "" {
+		notifiers = append(notifiers, newExecNotifier(config.Exec))
+	}
+	return notifiers
+}
+
+// notify dispatches the results to the configured notifiers, giving each one
+// only the domains routed to it. Failures are logged and never abort the run.
+// It returns the domains that a notifier failed for, by name.
+func notify(ctx context.Context, domains []Domain, email bool) map[string]bool {
+	config := ctx.Value(configKey{}).(*Config)
+	failed := map[string]bool{}
+	for _, n := range configuredNotifiers(ctx, email) {
+		routed := []Domain{}
+		for _, domain := range domains {
+			if routesTo(domain, n.Name(), config.DefaultNotifiers) {
+				routed = append(routed, domain)
+			}
+		}
+		if err := n.Notify(ctx, routed); err != nil {
+			slog.Error("failed to notify", "notifier", n.Name(), "error", err.Error())
+			for _, domain := range routed {
+				failed[domain.NameRef] = true
+			}
+		}
+	}
+	return failed
+}
+
+// logReceipt records, when delivery receipts are enabled, that a
+// notification about the domains was sent to the target or failed.
+func logReceipt(ctx context.Context, notifier string, target string, domains []string, err error) {
+	config := ctx.Value(configKey{}).(*Config)
+	if !config.DeliveryReceipts {
+		return
+	}
+	attrs := []any{
+		"notifier", notifier,
+		"target", target,
+		"domain", strings.Join(domains, ","),
+		"sent_at", time.Now().UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		attrs = append(attrs, "status", "failed", "error", err.Error())
+	} else {
+		attrs = append(attrs, "status", "sent")
+	}
+	slog.Info("delivery receipt", attrs...)
+}
+
+func domainRefs(domains []Domain) []string {
+	refs := []string{}
+	for _, domain := range domains {
+		refs = append(refs, domain.NameRef)
+	}
+	return refs
+}
+
+// emailTarget names the recipients and the relay of emails in receipts.
+func emailTarget(config SMTPConfig) string {
+	return fmt.Sprintf("%s via %s", strings.Join(config.To, ","), config.Server)
+}
+
+// resolvedMessage confirms that a domain's cert was renewed.
+func resolvedMessage(domain Domain) string {
+	return fmt.Sprintf("RESOLVED: %s cert renewed, now valid until %s\n\n%s\n", domain.NameRef, domain.Expires, domain.Summary)
+}
+
+// withBanner adds the configured header and footer around a notification
+// body.
+func withBanner(ctx context.Context, body string) string {
+	config := ctx.Value(configKey{}).(*Config)
+	if config.NotificationHeader != "" {
+		body = strings.TrimRight(config.NotificationHeader, "\n") + "\n\n" + body
+	}
+	if config.NotificationFooter != "" {
+		body = strings.TrimRight(body, "\n") + "\n\n" + strings.TrimRight(config.NotificationFooter, "\n") + "\n"
+	}
+	return body
+}
+
+// inMaintenance reports whether the maintenance marker file exists.
+func inMaintenance(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// checkNotifiers probes every configured notifier and writes one line per
+// notifier. It returns false if any check failed.
+func checkNotifiers(ctx context.Context, w io.Writer) bool {
+	ok := true
+	for _, n := range configuredNotifiers(ctx, true) {
+		if err := n.Check(ctx); err != nil {
+			fmt.Fprintf(w, "%s: failed: %s\n", n.Name(), err.Error())
+			ok = false
+			continue
+		}
+		fmt.Fprintf(w, "%s: OK\n", n.Name())
+	}
+	return ok
+}
+
+// routesTo reports whether the domain's alerts go to the named notifier.
+func routesTo(domain Domain, name string, defaults []string) bool {
+	if len(domain.Notifiers) > 0 {
+		return slices.Contains(domain.Notifiers, name)
+	}
+	if len(defaults) > 0 {
+		return slices.Contains(defaults, name)
+	}
+	return true
+}
+
+// emailNotifier sends one email per domain that is expiring soon or has a
+// problem.
+type emailNotifier struct{}
+
+func (emailNotifier) Name() string {
+	return "email"
+}
+
+func (emailNotifier) Notify(ctx context.Context, domains []Domain) error {
+	config := ctx.Value(configKey{}).(*Config)
+	var mu sync.Mutex
+	errs := []string{}
+	parallel(config.notifyConcurrency(), len(domains), func(i int) {
+		domain := domains[i]
+		if domain.Quiet {
+			slog.Debug("holding back repeat notification", "domain", domain.NameRef, "days_remaining", domain.DaysRemaining)
+			return
+		}
+		var err error
+		switch {
+		case domain.Resolved && slices.Contains(config.ResolvedNotifiers, "email"):
+			err = sendEmail(ctx, fmt.Sprintf("RESOLVED: %s", domain.NameRef), resolvedMessage(domain))
+		case domain.IsExpiringSoon:
+			subject := fmt.Sprintf("certificate expiration warning (%s): %s", domain.Severity, domain.NameRef)
+			err = sendEmail(ctx, subject, domain.Summary)
+		case domain.IsNotifiable():
+			subject := fmt.Sprintf("certificate warning: %s", domain.NameRef)
+			err = sendEmail(ctx, subject, domain.Summary)
+		default:
+			return
+		}
+		logReceipt(ctx, "email", emailTarget(config.SMTP), []string{domain.NameRef}, err)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Sprintf("%s: %s", domain.NameRef, err.Error()))
+			mu.Unlock()
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Check connects to the SMTP server, including STARTTLS when offered,
+// without sending a message.
+func (emailNotifier) Check(ctx context.Context) error {
+	config := ctx.Value(configKey{}).(*Config)
+	if config.SMTP.Server == "" {
+		return fmt.Errorf("no smtp server configured")
+	}
+	sc, err := newEmailDialer(config.SMTP).Dial()
+	if err != nil {
+		return err
+	}
+	return sc.Close()
+}
+
+// throttle spaces out consecutive sends to a notifier.
+type throttle struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+var (
+	throttlesMu sync.Mutex
+	throttles   = map[string]*throttle{}
+)
+
+// throttleFor returns the throttle for the named notifier, which lives for
+// the whole process so it also spaces out sends across daemon cycles.
+func throttleFor(name string) *throttle {
+	throttlesMu.Lock()
+	defer throttlesMu.Unlock()
+	t, ok := throttles[name]
+	if !ok {
+		t = &throttle{}
+		throttles[name] = t
+	}
+	return t
+}
+
+// wait blocks until at least interval has passed since the previous send.
+func (t *throttle) wait(name string, interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if wait := interval - time.Since(t.last); interval > 0 && wait > 0 {
+		slog.Warn("throttling notification", "notifier", name, "wait", wait.String())
+		time.Sleep(wait)
+	}
+	t.last = time.Now()
+}
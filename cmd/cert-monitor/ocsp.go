@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/exp/slices"
+)
+
+// oidTLSFeature is the TLS Feature extension (RFC 7633), and statusRequest
+// the feature it lists for Must-Staple.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+const statusRequest = 5
+
+// mustStaple reports whether the cert carries the Must-Staple TLS Feature.
+func mustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		return slices.Contains(features, statusRequest)
+	}
+	return false
+}
+
+// checkStaple records the OCSP response stapled by the server, if any, and
+// returns a problem description when the staple is missing, invalid or stale.
+func checkStaple(d *Domain, state tls.ConnectionState) string {
+	if len(state.OCSPResponse) == 0 {
+		return "server did not staple an OCSP response"
+	}
+	d.OCSPStapled = true
+
+	var issuer *x509.Certificate
+	if len(state.PeerCertificates) > 1 {
+		issuer = state.PeerCertificates[1]
+	}
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, state.PeerCertificates[0], issuer)
+	if err != nil {
+		return fmt.Sprintf("stapled OCSP response is invalid: %s", err.Error())
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		d.OCSPStatus = "good"
+	case ocsp.Revoked:
+		d.OCSPStatus = "revoked"
+	default:
+		d.OCSPStatus = "unknown"
+	}
+	if !resp.NextUpdate.IsZero() {
+		d.OCSPNextUpdate = resp.NextUpdate.Format("2006-01-02 15:04:05")
+	}
+
+	if resp.Status == ocsp.Revoked {
+		return "stapled OCSP response reports the cert as revoked"
+	}
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return fmt.Sprintf("stapled OCSP response is stale, next update was %s", d.OCSPNextUpdate)
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OTelConfig struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector, e.g.
+	// http://localhost:4318. Metrics are posted to <endpoint>/v1/metrics.
+	Endpoint string            `yaml:"endpoint,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+}
+
+// The types below are the subset of the OTLP/JSON metrics encoding needed to
+// export a gauge. 64 bit integers are encoded as strings, as OTLP/JSON expects.
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Unit        string    `json:"unit"`
+	Gauge       otlpGauge `json:"gauge"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsInt        string          `json:"asInt,omitempty"`
+	AsDouble     *float64        `json:"asDouble,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// exportOTel posts the days remaining and remaining validity ratio of every
+// domain to the configured OTLP collector as gauges.
+func exportOTel(ctx context.Context, domains []Domain) error {
+	config := ctx.Value(configKey{}).(*Config)
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	points := []otlpDataPoint{}
+	ratios := []otlpDataPoint{}
+	for _, domain := range domains {
+		attributes := []otlpAttribute{
+			{Key: "domain", Value: otlpValue{StringValue: domain.NameRef}},
+			{Key: "source", Value: otlpValue{StringValue: domain.Source}},
+		}
+		points = append(points, otlpDataPoint{
+			Attributes:   attributes,
+			TimeUnixNano: now,
+			AsInt:        strconv.Itoa(domain.DaysRemaining),
+		})
+		ratio := remainingRatio(domain)
+		ratios = append(ratios, otlpDataPoint{
+			Attributes:   attributes,
+			TimeUnixNano: now,
+			AsDouble:     &ratio,
+		})
+	}
+	body, err := json.Marshal(otlpMetricsRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "cert-monitor"}}},
+			},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope: otlpScope{Name: "cert-monitor", Version: VERSION},
+				Metrics: []otlpMetric{{
+					Name:        "cert.days_remaining",
+					Description: "Days until the certificate expires",
+					Unit:        "d",
+					Gauge:       otlpGauge{DataPoints: points},
+				}, {
+					Name:        "cert.validity_remaining_ratio",
+					Description: "Fraction of the certificate's validity left",
+					Unit:        "1",
+					Gauge:       otlpGauge{DataPoints: ratios},
+				}},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	url := strings.TrimSuffix(config.OTel.Endpoint, "/") + "/v1/metrics"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range config.OTel.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
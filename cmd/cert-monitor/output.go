@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formatter writes the results of a run in a particular output format.
+type Formatter interface {
+	Write(w io.Writer, domains []Domain) error
+}
+
+// formatters holds the output formats selectable with -format.
+var formatters = map[string]Formatter{}
+
+// RegisterFormatter makes a formatter available under the given name,
+// replacing any formatter already registered with that name.
+func RegisterFormatter(name string, f Formatter) {
+	formatters[name] = f
+}
+
+func init() {
+	RegisterFormatter("text", textFormatter{})
+	RegisterFormatter("json", jsonFormatter{})
+	RegisterFormatter("csv", csvFormatter{})
+	RegisterFormatter("table", tableFormatter{})
+	RegisterFormatter("junit", junitFormatter{})
+	RegisterFormatter("prometheus-text", prometheusFormatter{})
+	RegisterFormatter("grafana", grafanaFormatter{})
+	RegisterFormatter("html-report", htmlFormatter{})
+	RegisterFormatter("msgpack", msgpackFormatter{})
+}
+
+// formatterNames returns the registered format names in sorted order.
+func formatterNames() []string {
+	names := []string{}
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// textFormatter writes the human readable summary, sectioned by status with
+// Group or by the value of a label with GroupBy.
+type textFormatter struct {
+	Group   bool
+	GroupBy string
+}
+
+func (f textFormatter) Write(w io.Writer, domains []Domain) error {
+	if f.GroupBy != "" {
+		_, err := fmt.Fprintln(w, groupByLabel(domains, f.GroupBy))
+		return err
+	}
+	_, err := fmt.Fprintln(w, buildSummary(domains, f.Group))
+	return err
+}
+
+// humanFields are the Domain fields left out of raw output, since they only
+// restate other fields for people to read.
+var humanFields = []string{"Summary", "ExpiresIn"}
+
+// jsonFormatter writes the full results as an indented json array. Raw
+// leaves out the humanFields.
+type jsonFormatter struct {
+	Raw bool
+}
+
+func (f jsonFormatter) Write(w io.Writer, domains []Domain) error {
+	var results any = domains
+	if f.Raw {
+		raw, err := rawDomains(domains)
+		if err != nil {
+			return fmt.Errorf("failed to encode results: %w", err)
+		}
+		results = raw
+	}
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode results: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// rawDomains converts the domains to json objects without the humanFields.
+func rawDomains(domains []Domain) ([]map[string]any, error) {
+	raw := []map[string]any{}
+	for _, d := range domains {
+		b, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]any{}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return nil, err
+		}
+		for _, name := range humanFields {
+			delete(fields, name)
+		}
+		raw = append(raw, fields)
+	}
+	return raw, nil
+}
+
+// grafanaRow is one domain as read by the Grafana JSON and Infinity
+// datasources. The keys are stable so dashboards can rely on them.
+type grafanaRow struct {
+	Domain        string `json:"domain"`
+	DaysRemaining int    `json:"days_remaining"`
+	Status        Status `json:"status"`
+	Expires       string `json:"expires"`
+}
+
+// grafanaFormatter writes a flat json array of grafanaRow.
+type grafanaFormatter struct{}
+
+func (grafanaFormatter) Write(w io.Writer, domains []Domain) error {
+	rows := []grafanaRow{}
+	for _, d := range domains {
+		rows = append(rows, grafanaRow{
+			Domain:        d.NameRef,
+			DaysRemaining: d.DaysRemaining,
+			Status:        d.Status,
+			Expires:       d.Expires,
+		})
+	}
+	out, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode results: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// csvFormatter writes one row per domain with a header row. None of its
+// columns are meant only for people, so Raw only joins the problems with a
+// bare ; for splitting.
+type csvFormatter struct {
+	Raw bool
+}
+
+func (f csvFormatter) Write(w io.Writer, domains []Domain) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"domain", "common_name", "expires", "days_remaining", "status", "severity", "problems"})
+	separator := "; "
+	if f.Raw {
+		separator = ";"
+	}
+	for _, d := range domains {
+		problems := strings.Join(d.Problems, separator)
+		cw.Write([]string{
+			d.NameRef,
+			d.CommonName,
+			d.Expires,
+			strconv.Itoa(d.DaysRemaining),
+			string(d.Status),
+			string(d.Severity),
+			problems,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tableFormatter writes an aligned table for reading in a terminal.
+type tableFormatter struct{}
+
+func (tableFormatter) Write(w io.Writer, domains []Domain) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tCOMMON NAME\tEXPIRES\tDAYS\tSTATUS\tPROBLEMS\tSEVERITY  LIFETIME")
+	for _, d := range domains {
+		// severity and the lifetime bar share the last column, padded by
+		// hand, so their color codes do not throw off the alignment
+		severity := paint(w, d.Severity, fmt.Sprintf("%-8s", d.Severity))
+		bar := paint(w, d.Severity, lifetimeBar(d.ElapsedPercent))
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%d\t%s  %s\n", d.NameRef, d.CommonName, d.Expires, d.DaysRemaining, d.Status, len(d.Problems), severity, bar)
+	}
+	return tw.Flush()
+}
+
+const lifetimeBarWidth = 20
+
+// lifetimeBar draws how much of the cert's lifetime has elapsed, such as
+// [#######-------------]  35%.
+func lifetimeBar(percent float64) string {
+	filled := int(percent / 100 * lifetimeBarWidth)
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", filled), strings.Repeat("-", lifetimeBarWidth-filled), percent)
+}
+
+// buildSummary joins the domain summaries, optionally sectioned by status.
+func buildSummary(domains []Domain, grouped bool) string {
+	summaryLines := []string{}
+	if !grouped {
+		for _, domain := range domains {
+			summaryLines = append(summaryLines, domain.Summary)
+			summaryLines = append(summaryLines, "")
+		}
+		return strings.Join(summaryLines, "\n")
+	}
+
+	for _, status := range []Status{StatusExpired, StatusExpiring, StatusOK} {
+		count := 0
+		section := []string{}
+		for _, domain := range domains {
+			if domain.Status == status {
+				count++
+				section = append(section, domain.Summary)
+				section = append(section, "")
+			}
+		}
+		summaryLines = append(summaryLines, fmt.Sprintf("%s (%d)", status, count))
+		summaryLines = append(summaryLines, "")
+		summaryLines = append(summaryLines, section...)
+	}
+	return strings.Join(summaryLines, "\n")
+}
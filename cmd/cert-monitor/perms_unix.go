@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkConfigPermissions returns an error if the config file can be read by
+// any user on the system.
+func checkConfigPermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if mode := info.Mode().Perm(); mode&0o004 != 0 {
+		return fmt.Errorf("config file %s contains secrets but is world-readable (mode %04o)", path, mode)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import "sync"
+
+const (
+	defaultCheckConcurrency  = 10
+	defaultNotifyConcurrency = 5
+)
+
+// parallel calls fn for every index below count, running at most workers
+// calls at once, and returns once all of them have.
+func parallel(workers int, count int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+func (c Config) checkConcurrency() int {
+	if c.CheckConcurrency > 0 {
+		return c.CheckConcurrency
+	}
+	return defaultCheckConcurrency
+}
+
+func (c Config) notifyConcurrency() int {
+	if c.NotifyConcurrency > 0 {
+		return c.NotifyConcurrency
+	}
+	return defaultNotifyConcurrency
+}
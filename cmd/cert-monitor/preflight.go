@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const defaultPreflightTimeout = 5 * time.Second
+
+// PreflightConfig checks that the environment can resolve and reach hosts
+// at all before the run, so a broken network fails fast instead of failing
+// every domain one timeout at a time.
+type PreflightConfig struct {
+	// Canary is a host:port that must resolve and accept a connection.
+	Canary string `yaml:"canary,omitempty"`
+	// Sample is how many of the configured domains are tried, at least one
+	// of which must resolve and accept a connection.
+	Sample  int           `yaml:"sample,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+func (c PreflightConfig) enabled() bool {
+	return c.Canary != "" || c.Sample > 0
+}
+
+// preflight runs the canary and sample checks, returning why the
+// environment looks broken.
+func preflight(ctx context.Context, cfgDomains []DomainConfig) error {
+	config := ctx.Value(configKey{}).(*Config)
+	timeout := config.Preflight.Timeout
+	if timeout == 0 {
+		timeout = defaultPreflightTimeout
+	}
+
+	if config.Preflight.Canary != "" {
+		host, port, err := net.SplitHostPort(config.Preflight.Canary)
+		if err != nil {
+			return fmt.Errorf("invalid preflight canary %q, expected host:port", config.Preflight.Canary)
+		}
+		if err := reachable(ctx, host, port, timeout); err != nil {
+			return fmt.Errorf("canary %s: %w", config.Preflight.Canary, err)
+		}
+	}
+
+	// Only dialed domains say anything about the network
+	sample := []DomainConfig{}
+	for _, dc := range cfgDomains {
+		if len(sample) == config.Preflight.Sample {
+			break
+		}
+		if dc.File == "" && dc.conn == nil {
+			sample = append(sample, dc)
+		}
+	}
+	errs := []string{}
+	for _, dc := range sample {
+		host, port := dc.hostPort()
+		if dc.Address != "" {
+			host = dc.Address
+		}
+		err := reachable(ctx, host, port, timeout)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", dc.ref(), err.Error()))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("no sampled domain is reachable: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reachable resolves the host and opens a TCP connection to it.
+func reachable(ctx context.Context, host string, port string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("dns resolution failed: %w", err)
+	}
+	var conn net.Conn
+	dialer := &net.Dialer{}
+	netnsErr := withNetns(ctx.Value(configKey{}).(*Config).NetNS, func() error {
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+		return nil
+	})
+	if netnsErr != nil {
+		return netnsErr
+	}
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	conn.Close()
+	slog.Debug("preflight passed", "host", host, "port", port)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const probeTimeout = 30 * time.Second
+
+// HTTPProbeConfig sends a request over the checked connection, for endpoints
+// behind gateways that expect specific headers before they route a client.
+type HTTPProbeConfig struct {
+	Path    string            `yaml:"path,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+func (c HTTPProbeConfig) enabled() bool {
+	return c.Path != "" || len(c.Headers) > 0
+}
+
+// probeHTTP sends a GET request with the configured headers over conn and
+// returns the response status code.
+func probeHTTP(conn *tls.Conn, host string, probe HTTPProbeConfig) (int, error) {
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	path := probe.Path
+	if path == "" {
+		path = "/"
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s%s", host, path), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "cert-monitor/"+VERSION)
+	for k, v := range probe.Headers {
+		req.Header.Set(k, v)
+	}
+	if err := req.Write(conn); err != nil {
+		return 0, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
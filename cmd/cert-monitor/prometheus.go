@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// promMetric is a gauge written once per domain in the Prometheus text
+// exposition format. The days remaining gauge mirrors cert.days_remaining
+// from the OpenTelemetry export.
+type promMetric struct {
+	name  string
+	help  string
+	value func(d Domain) float64
+}
+
+var promMetrics = []promMetric{
+	{"cert_days_remaining", "Days until the certificate expires", func(d Domain) float64 { return float64(d.DaysRemaining) }},
+	{"cert_lifetime_days", "Total validity of the certificate in days", func(d Domain) float64 { return float64(d.LifetimeDays) }},
+	{"cert_validity_remaining_ratio", "Fraction of the certificate's validity left, from 1 when issued to 0 when expired", remainingRatio},
+	{"cert_expiring", "Whether the certificate is within the threshold of expiry", func(d Domain) float64 { return boolValue(d.IsExpiringSoon) }},
+	{"cert_problems", "Number of problems flagged for the certificate", func(d Domain) float64 { return float64(len(d.Problems)) }},
+	{"cert_tcp_connect_seconds", "Time to establish the TCP connection", func(d Domain) float64 { return d.TCPConnectSeconds }},
+	{"cert_tls_handshake_seconds", "Time to complete the TLS handshake", func(d Domain) float64 { return d.TLSHandshakeSeconds }},
+}
+
+// prometheusFormatter writes the run's gauges in the Prometheus text
+// exposition format, for redirecting to a file or piping to a push client.
+type prometheusFormatter struct{}
+
+func (prometheusFormatter) Write(w io.Writer, domains []Domain) error {
+	for _, m := range promMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+		for _, d := range domains {
+			if _, err := fmt.Fprintf(w, "%s{domain=\"%s\",common_name=\"%s\",source=\"%s\"} %s\n", m.name, promEscape(d.NameRef), promEscape(d.CommonName), promEscape(d.Source), strconv.FormatFloat(m.value(d), 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// every served cert, so intermediates can be alerted on separately
+	fmt.Fprintln(w, "# HELP cert_expiry_seconds Unix time the certificate expires, for every cert in the served chain")
+	fmt.Fprintln(w, "# TYPE cert_expiry_seconds gauge")
+	for _, d := range domains {
+		for _, c := range d.Chain {
+			if _, err := fmt.Fprintf(w, "cert_expiry_seconds{domain=\"%s\",position=\"%s\",subject=\"%s\",source=\"%s\"} %d\n", promEscape(d.NameRef), c.Position, promEscape(c.Subject), promEscape(d.Source), c.NotAfter.Unix()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// promEscape escapes a label value as the exposition format requires.
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// remainingRatio is the fraction of the cert's lifetime still ahead, for
+// alerting alike on certs of any lifetime.
+func remainingRatio(d Domain) float64 {
+	return 1 - d.ElapsedPercent/100
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
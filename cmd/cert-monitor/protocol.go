@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// tlsVersions maps the versions accepted in the config to their protocol
+// numbers, oldest first.
+var tlsVersions = []struct {
+	name    string
+	version uint16
+}{
+	{"1.0", tls.VersionTLS10},
+	{"1.1", tls.VersionTLS11},
+	{"1.2", tls.VersionTLS12},
+	{"1.3", tls.VersionTLS13},
+}
+
+// checkRejectBelow offers the server only the versions older than minimum,
+// and every cipher suite, and returns a problem if it completes the
+// handshake anyway, or if the probe could not reach the server to tell.
+func checkRejectBelow(ctx context.Context, host string, port string, tlsConfig *tls.Config, negotiate negotiator, minimum string) (string, error) {
+	var below uint16
+	for i, v := range tlsVersions {
+		if v.name == minimum && i > 0 {
+			below = tlsVersions[i-1].version
+		}
+	}
+	if below == 0 {
+		return "", fmt.Errorf("unsupported reject_below version %q, expected 1.1, 1.2 or 1.3", minimum)
+	}
+
+	probeConfig := tlsConfig.Clone()
+	probeConfig.MinVersion = tls.VersionTLS10
+	probeConfig.MaxVersion = below
+	probeConfig.ClientSessionCache = nil
+	probeConfig.SessionTicketsDisabled = true
+	probeConfig.Renegotiation = tls.RenegotiateNever
+	// Suites a tls_profile limits the check to are replaced, since old
+	// versions may only share the suites it leaves out
+	probeConfig.CipherSuites = nil
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		probeConfig.CipherSuites = append(probeConfig.CipherSuites, suite.ID)
+	}
+
+	conn, _, err := dialDomain(ctx, host, port, probeConfig, negotiate)
+	if err != nil && refusedHandshake(err) {
+		slog.Debug("old protocol versions rejected", "domain", host, "below", minimum, "error", err.Error())
+		return "", nil
+	}
+	if err != nil {
+		return fmt.Sprintf("could not check that versions below TLS %s are rejected: %s", minimum, err.Error()), nil
+	}
+	defer conn.Close()
+	return fmt.Sprintf("accepted %s although versions below TLS %s should be rejected", tls.VersionName(conn.ConnectionState().Version), minimum), nil
+}
+
+// refusedHandshake reports whether err is the server turning down the
+// handshake, with an alert, a reply that is not a TLS record, a version or
+// suite that was not offered, or by dropping the connection. Anything else,
+// such as a lookup, connect or starttls failure or a timeout, means the
+// probe never got an answer.
+func refusedHandshake(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &recordErr):
+		return true
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		return true
+	case errors.Is(err, errHandshakeReset):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return false
+	}
+	return strings.HasPrefix(err.Error(), "tls: ")
+}
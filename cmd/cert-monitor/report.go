@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// reportTimeFormat names report files so they sort by the time they were
+// written.
+const reportTimeFormat = "20060102T150405Z"
+
+// reportPattern matches the names of the report files written by
+// writeReport. Pruning never touches any other file in the directory.
+var reportPattern = regexp.MustCompile(`^report-\d{8}T\d{6}Z\.json$`)
+
+// ReportRetention bounds the reports kept in the report directory, by count,
+// by age, or both. Zero values keep every report.
+type ReportRetention struct {
+	Count  int           `yaml:"count,omitempty"`
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+}
+
+// writeReport writes the full results of a run as json into dir, named by
+// the current time, and returns the file's path.
+func writeReport(dir string, domains []Domain) (string, error) {
+	out, err := json.MarshalIndent(domains, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode results: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("report-%s.json", time.Now().UTC().Format(reportTimeFormat)))
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// pruneReports removes the reports in dir beyond the retention count and
+// those older than the retention age, judged by the time in their name.
+func pruneReports(dir string, retention ReportRetention) error {
+	if retention.Count <= 0 && retention.MaxAge <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && reportPattern.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for i, name := range names {
+		expired := false
+		if retention.Count > 0 && i >= retention.Count {
+			expired = true
+		}
+		if retention.MaxAge > 0 {
+			written, err := time.Parse(reportTimeFormat, name[len("report-"):len(name)-len(".json")])
+			if err == nil && time.Since(written) > retention.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// printResolved resolves every configured domain without dialing it and
+// writes one line per domain with its addresses or the resolution error.
+// Domains with an address resolve that instead, since it is what is dialed.
+func printResolved(ctx context.Context, w io.Writer, cfgDomains []DomainConfig) {
+	for _, dc := range cfgDomains {
+		if dc.File != "" {
+			continue
+		}
+		host, _ := dc.hostPort()
+		if dc.Address != "" {
+			host = dc.Address
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			fmt.Fprintf(w, "%s: error: %s\n", dc.ref(), err.Error())
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", dc.ref(), strings.Join(addrs, ", "))
+	}
+}
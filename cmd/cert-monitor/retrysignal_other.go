@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// retrySignals is empty, since there is no SIGUSR1 to retry failed domains
+// on outside Unix.
+func retrySignals() []os.Signal {
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// retrySignals are the signals that make the daemon retry the domains that
+// failed their last check.
+func retrySignals() []os.Signal {
+	return []os.Signal{syscall.SIGUSR1}
+}
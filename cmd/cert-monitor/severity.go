@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// Severity grades how urgently a domain needs attention, based on the
+// configured bands of days remaining.
+type Severity string
+
+const (
+	SeverityOK       Severity = "ok"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+const (
+	defaultCriticalDays = 7
+	defaultWarningDays  = 30
+)
+
+// SeverityConfig sets the bands: fewer than Critical days remaining is
+// critical, fewer than Warning days is a warning.
+type SeverityConfig struct {
+	Critical int `yaml:"critical,omitempty"`
+	Warning  int `yaml:"warning,omitempty"`
+}
+
+func severityFor(config SeverityConfig, daysRemaining int) Severity {
+	critical := config.Critical
+	if critical == 0 {
+		critical = defaultCriticalDays
+	}
+	warning := config.Warning
+	if warning == 0 {
+		warning = defaultWarningDays
+	}
+
+	switch {
+	case daysRemaining < critical:
+		return SeverityCritical
+	case daysRemaining < warning:
+		return SeverityWarning
+	}
+	return SeverityOK
+}
+
+// exitCode maps the worst result of a run to a monitoring plugin style exit
+// code: 0 ok, 1 warning, 2 critical, 3 when a domain could not be checked.
+func exitCode(domains []Domain) int {
+	code := 0
+	for _, domain := range domains {
+		c := 0
+		switch {
+		case domain.Status == StatusError:
+			c = 3
+		case domain.Severity == SeverityCritical:
+			c = 2
+		case domain.Severity == SeverityWarning:
+			c = 1
+		}
+		if c > code {
+			code = c
+		}
+	}
+	return code
+}
+
+var severityColors = map[Severity]string{
+	SeverityOK:       "\033[32m",
+	SeverityWarning:  "\033[33m",
+	SeverityCritical: "\033[31m",
+}
+
+// paint wraps text in the severity's terminal color when w is a terminal.
+func paint(w io.Writer, severity Severity, text string) string {
+	f, ok := w.(*os.File)
+	if !ok {
+		return text
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return text
+	}
+	return severityColors[severity] + text + "\033[0m"
+}
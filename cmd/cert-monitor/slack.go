@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+type SlackConfig struct {
+	// WebhookURL is a Slack incoming webhook.
+	WebhookURL string `yaml:"webhook_url,omitempty"`
+	// Blocks sends Block Kit messages, with the expiry in fields and a
+	// button per action, instead of plain text.
+	Blocks bool `yaml:"blocks,omitempty"`
+	// Actions are buttons added to Block Kit messages. {domain} in the URL
+	// is replaced by the domain. Domains with a runbook_url also get a
+	// Runbook button.
+	Actions     []SlackAction `yaml:"actions,omitempty"`
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+}
+
+type SlackAction struct {
+	Text string `yaml:"text,omitempty"`
+	URL  string `yaml:"url,omitempty"`
+}
+
+// slackNotifier posts one message per notifiable domain to an incoming
+// webhook.
+type slackNotifier struct {
+	config SlackConfig
+	client *http.Client
+}
+
+func newSlackNotifier(config SlackConfig) *slackNotifier {
+	return &slackNotifier{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (n *slackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, domains []Domain) error {
+	config := ctx.Value(configKey{}).(*Config)
+	var mu sync.Mutex
+	errs := []string{}
+	parallel(config.notifyConcurrency(), len(domains), func(i int) {
+		domain := domains[i]
+		var message map[string]any
+		switch {
+		case domain.Quiet:
+			return
+		case domain.Resolved && slices.Contains(config.ResolvedNotifiers, n.Name()):
+			message = map[string]any{"text": withBanner(ctx, fmt.Sprintf("RESOLVED: %s cert renewed, now valid until %s", domain.NameRef, domain.Expires))}
+		case domain.IsNotifiable():
+			message = n.message(ctx, domain)
+		default:
+			return
+		}
+		err := n.post(ctx, message)
+		logReceipt(ctx, n.Name(), webhookHost(n.config.WebhookURL), []string{domain.NameRef}, err)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Sprintf("%s: %s", domain.NameRef, err.Error()))
+			mu.Unlock()
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// message builds the webhook payload for a domain, as Block Kit when
+// configured. The text is kept as the fallback shown in notifications. The
+// notification header and footer go around the text, and in context blocks
+// at the start and end of the blocks.
+func (n *slackNotifier) message(ctx context.Context, domain Domain) map[string]any {
+	config := ctx.Value(configKey{}).(*Config)
+	title := fmt.Sprintf("certificate warning: %s", domain.NameRef)
+	if domain.IsExpiringSoon {
+		title = fmt.Sprintf("certificate expiration warning (%s): %s", domain.Severity, domain.NameRef)
+	}
+	text := withBanner(ctx, fmt.Sprintf("%s\n```\n%s\n```", title, domain.Summary))
+	if !n.config.Blocks {
+		return map[string]any{"text": text}
+	}
+
+	blocks := []map[string]any{}
+	if config.NotificationHeader != "" {
+		blocks = append(blocks, slackContext(config.NotificationHeader))
+	}
+	blocks = append(blocks,
+		map[string]any{"type": "header", "text": map[string]any{"type": "plain_text", "text": title}},
+		map[string]any{"type": "section", "fields": []map[string]any{
+			slackField("Expires", fmt.Sprintf("%s (%s)", domain.Expires, domain.ExpiresIn)),
+			slackField("Days left", fmt.Sprintf("%d", domain.DaysRemaining)),
+			slackField("Status", string(domain.Status)),
+			slackField("Severity", string(domain.Severity)),
+			slackField("Source", domain.Source),
+		}},
+	)
+	if len(domain.Problems) > 0 {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": "*Problems*\n• " + strings.Join(domain.Problems, "\n• ")},
+		})
+	}
+
+	buttons := []map[string]any{}
+	if domain.RunbookURL != "" {
+		buttons = append(buttons, slackButton("Runbook", domain.RunbookURL))
+	}
+	for _, action := range n.config.Actions {
+		buttons = append(buttons, slackButton(action.Text, strings.ReplaceAll(action.URL, "{domain}", domain.NameRef)))
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, map[string]any{"type": "actions", "elements": buttons})
+	}
+	if config.NotificationFooter != "" {
+		blocks = append(blocks, slackContext(config.NotificationFooter))
+	}
+	return map[string]any{"text": text, "blocks": blocks}
+}
+
+// slackContext is a block of small print, for the notification header and
+// footer.
+func slackContext(text string) map[string]any {
+	return map[string]any{
+		"type":     "context",
+		"elements": []map[string]any{{"type": "mrkdwn", "text": strings.TrimRight(text, "\n")}},
+	}
+}
+
+// webhookHost names a webhook in receipts without the secret in its path.
+func webhookHost(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Host
+}
+
+func slackField(name string, value string) map[string]any {
+	return map[string]any{"type": "mrkdwn", "text": fmt.Sprintf("*%s:*\n%s", name, value)}
+}
+
+func slackButton(text string, url string) map[string]any {
+	return map[string]any{
+		"type": "button",
+		"text": map[string]any{"type": "plain_text", "text": text},
+		"url":  url,
+	}
+}
+
+// Check posts an empty message, which Slack rejects without posting
+// anything, to confirm the webhook exists.
+func (n *slackNotifier) Check(ctx context.Context) error {
+	status, body, err := n.send(ctx, map[string]any{})
+	if err != nil {
+		return err
+	}
+	if status == http.StatusBadRequest && (body == "no_text" || body == "invalid_payload") {
+		return nil
+	}
+	return fmt.Errorf("slack returned %d %s", status, body)
+}
+
+func (n *slackNotifier) post(ctx context.Context, message map[string]any) error {
+	throttleFor(n.Name()).wait(n.Name(), n.config.MinInterval)
+	status, body, err := n.send(ctx, message)
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("slack returned %d %s", status, body)
+	}
+	return nil
+}
+
+func (n *slackNotifier) send(ctx context.Context, message map[string]any) (int, string, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return 0, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, strings.TrimSpace(string(body)), nil
+}
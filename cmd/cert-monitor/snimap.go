@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SNIMapping is one entry of an sni_map file: the name sent as the SNI and
+// the cert it is expected to yield.
+type SNIMapping struct {
+	SNI string `yaml:"sni"`
+	// Fingerprint is the hex SHA-256 of the expected cert, with or without
+	// colons.
+	Fingerprint string `yaml:"fingerprint,omitempty"`
+	CommonName  string `yaml:"common_name,omitempty"`
+}
+
+// loadSNIMap reads an sni_map file, a YAML list of mappings.
+func loadSNIMap(path string) ([]SNIMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sni_map: %w", err)
+	}
+	mappings := []SNIMapping{}
+	if err := yaml.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse sni_map %s: %w", path, err)
+	}
+	for i, m := range mappings {
+		if m.SNI == "" {
+			return nil, fmt.Errorf("sni_map %s entry %d has no sni", path, i)
+		}
+		if m.Fingerprint == "" && m.CommonName == "" {
+			return nil, fmt.Errorf("sni_map %s entry %s needs a fingerprint or a common_name", path, m.SNI)
+		}
+	}
+	return mappings, nil
+}
+
+// expandSNIMaps replaces every entry with an sni_map by one entry per
+// mapping, sending its SNI to the entry's address and expecting its cert.
+func expandSNIMaps(cfgDomains []DomainConfig) ([]DomainConfig, error) {
+	expanded := []DomainConfig{}
+	for _, dc := range cfgDomains {
+		if dc.SNIMap == "" {
+			expanded = append(expanded, dc)
+			continue
+		}
+		mappings, err := loadSNIMap(dc.SNIMap)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mappings {
+			probe := dc
+			probe.Name = m.SNI
+			probe.ProbeName = m.SNI
+			probe.SNIMap = ""
+			probe.ExpectedFingerprint = m.Fingerprint
+			probe.ExpectedCommonName = m.CommonName
+			expanded = append(expanded, probe)
+		}
+	}
+	return expanded, nil
+}
+
+// normalizeFingerprint makes fingerprints written as AB:CD:.. comparable to
+// the ones reported.
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
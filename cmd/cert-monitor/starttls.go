@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+const negotiateTimeout = 30 * time.Second
+
+// negotiator speaks the plaintext part of a protocol on conn, up to the point
+// where the client may start the TLS handshake.
+type negotiator func(conn net.Conn) error
+
+var startTLSNegotiators = map[string]negotiator{
+	"smtp":    negotiateSMTP,
+	"imap":    negotiateIMAP,
+	"pop3":    negotiatePOP3,
+	"mysql":   negotiateMySQL,
+	"mongodb": negotiateMongoDB,
+}
+
+// startTLSPorts are the ports used when a starttls domain has none set.
+var startTLSPorts = map[string]string{
+	"smtp":    "587",
+	"imap":    "143",
+	"pop3":    "110",
+	"mysql":   "3306",
+	"mongodb": "27017",
+}
+
+// helloName is the name the client introduces itself with.
+func helloName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
+
+func negotiateSMTP(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("EHLO %s", helloName()); err != nil {
+		return err
+	}
+	if _, _, err := tp.ReadResponse(250); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, _, err := tp.ReadResponse(220)
+	return err
+}
+
+func negotiateIMAP(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := tp.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a001 ") {
+			if !strings.HasPrefix(line, "a001 OK") {
+				return fmt.Errorf("starttls refused: %s", line)
+			}
+			return nil
+		}
+	}
+}
+
+func negotiatePOP3(conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := tp.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("starttls refused: %s", line)
+	}
+	return nil
+}
+
+// smtpAuth authenticates with AUTH PLAIN over an upgraded smtp connection.
+func smtpAuth(conn *tls.Conn, auth SMTPAuthConfig) error {
+	conn.SetDeadline(time.Now().Add(negotiateTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	tp := textproto.NewConn(conn)
+	if err := tp.PrintfLine("EHLO %s", helloName()); err != nil {
+		return err
+	}
+	if _, _, err := tp.ReadResponse(250); err != nil {
+		return err
+	}
+	creds := base64.StdEncoding.EncodeToString([]byte("\x00" + auth.Username + "\x00" + auth.Password))
+	if err := tp.PrintfLine("AUTH PLAIN %s", creds); err != nil {
+		return err
+	}
+	if _, _, err := tp.ReadResponse(235); err != nil {
+		return err
+	}
+	return tp.PrintfLine("QUIT")
+}
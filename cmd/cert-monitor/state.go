@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+)
+
+// State is what is remembered about each domain between runs.
+type State struct {
+	Domains map[string]DomainState
+}
+
+type DomainState struct {
+	CommonName string
+	DNSNames   []string
+	// Notified is what the domain looked like when it was last notified
+	// about, empty if it has not been since it was last healthy.
+	NotifiedStatus   Status
+	NotifiedSeverity Severity
+	NotifiedDays     int
+	// NotifiedKey is the dedup_key it was last notified under, empty
+	// without one.
+	NotifiedKey string
+	// Error is why the last check failed, empty if it succeeded.
+	Error string
+	// Status and Days are the status and days remaining last seen.
+	Status Status
+	Days   int
+}
+
+// checked reports whether the domain was ever checked successfully.
+func (s DomainState) checked() bool {
+	return s.CommonName != "" || len(s.DNSNames) > 0
+}
+
+// failedDomains returns the domains whose last check failed.
+func failedDomains(state *State, cfgDomains []DomainConfig) []DomainConfig {
+	failed := []DomainConfig{}
+	for _, dc := range cfgDomains {
+		if state.Domains[dc.ref()].Error != "" {
+			failed = append(failed, dc)
+		}
+	}
+	return failed
+}
+
+// loadState reads the state file. A missing file is an empty state.
+func loadState(path string) (*State, error) {
+	state := &State{Domains: map[string]DomainState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if state.Domains == nil {
+		state.Domains = map[string]DomainState{}
+	}
+	return state, nil
+}
+
+// saveState writes the state file atomically.
+func saveState(path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+// writeFileAtomic replaces the file with data through a rename, so readers
+// never see it partly written.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cert-monitor-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// applyState compares the results against the previous run, flagging domains
+// whose common name or DNS names changed, and records the new results and
+// errors. With a notifyDelta, expiring domains that have not changed enough
+// since they were last notified about under the same dedupKey are marked
+// quiet. Domains that were notified about for expiry and are now healthy are
+// marked resolved. With trend, the summary describes how the domain changed
+// since the previous run. What was notified is kept as it was, since only
+// applyNotified knows whether a notification was sent.
+func applyState(state *State, domains []Domain, notifyDelta int, trend bool, dedupKey *template.Template) {
+	for i := range domains {
+		d := &domains[i]
+		// Errors are recorded for -retry-failed, keeping what was last seen
+		if d.Status == StatusError {
+			prev := state.Domains[d.NameRef]
+			prev.Error = d.Error
+			state.Domains[d.NameRef] = prev
+			continue
+		}
+
+		prev, seen := state.Domains[d.NameRef]
+		seen = seen && prev.checked()
+		if seen {
+			if prev.CommonName != d.CommonName {
+				d.Problems = append(d.Problems, fmt.Sprintf("common name changed from %s to %s", prev.CommonName, d.CommonName))
+			}
+			if !sameNames(prev.DNSNames, d.DNSNames) {
+				d.Problems = append(d.Problems, fmt.Sprintf("DNS names changed from %s to %s", strings.Join(prev.DNSNames, ", "), strings.Join(d.DNSNames, ", ")))
+			}
+		}
+		if trend {
+			d.Trend = describeTrend(prev, d)
+		}
+		if seen || trend {
+			d.Summary = summarize(d)
+		}
+
+		// A cert that was alerted on for expiry and is now healthy was renewed
+		if (prev.NotifiedStatus == StatusExpiring || prev.NotifiedStatus == StatusExpired) && !d.IsNotifiable() {
+			d.Resolved = true
+		}
+
+		if d.IsNotifiable() && notifyDelta > 0 && seen && len(d.Problems) == 0 && prev.NotifiedKey == renderDedupKey(dedupKey, d) && withinDelta(prev, d, notifyDelta) {
+			d.Quiet = true
+		}
+
+		next := prev
+		next.CommonName = d.CommonName
+		next.DNSNames = d.DNSNames
+		next.Error = ""
+		next.Status = d.Status
+		next.Days = d.DaysRemaining
+		state.Domains[d.NameRef] = next
+	}
+}
+
+// applyNotified records what the domains looked like when they were
+// notified about, once the notifications have been sent. Domains that were
+// quiet or whose notification failed are left as they were, so a failed
+// send is retried on the next run instead of being held back. Healthy
+// domains are cleared, their resolution having been sent.
+func applyNotified(state *State, domains []Domain, failed map[string]bool, dedupKey *template.Template) {
+	for i := range domains {
+		d := &domains[i]
+		if d.Status == StatusError || d.Quiet || failed[d.NameRef] {
+			continue
+		}
+		refs := d.Hostnames
+		if len(refs) == 0 {
+			refs = []string{d.NameRef}
+		}
+		for _, ref := range refs {
+			s := state.Domains[ref]
+			s.NotifiedStatus, s.NotifiedSeverity, s.NotifiedDays, s.NotifiedKey = "", "", 0, ""
+			if d.IsNotifiable() {
+				s.NotifiedStatus = d.Status
+				s.NotifiedSeverity = d.Severity
+				s.NotifiedDays = d.DaysRemaining
+				s.NotifiedKey = renderDedupKey(dedupKey, d)
+			}
+			state.Domains[ref] = s
+		}
+	}
+}
+
+// dedupKey parses the dedup_key template, nil when none is set. It is
+// checked by validate, so a broken template is treated as unset.
+func (c Config) dedupKey() *template.Template {
+	if c.DedupKey == "" {
+		return nil
+	}
+	tmpl, err := template.New("dedup_key").Option("missingkey=zero").Parse(c.DedupKey)
+	if err != nil {
+		return nil
+	}
+	return tmpl
+}
+
+// renderDedupKey executes the dedup_key template over the domain. Without
+// a template, or if it fails, the key is empty, which every run of the
+// domain shares.
+func renderDedupKey(tmpl *template.Template, d *Domain) string {
+	if tmpl == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		slog.Warn("failed to render dedup_key", "domain", d.NameRef, "error", err.Error())
+		return ""
+	}
+	return buf.String()
+}
+
+// describeTrend tells how the days remaining and status changed since they
+// were last seen.
+func describeTrend(prev DomainState, d *Domain) string {
+	if prev.Status == "" {
+		return "first observation"
+	}
+	changes := []string{}
+	switch {
+	case d.DaysRemaining < prev.Days:
+		changes = append(changes, fmt.Sprintf("days remaining dropped from %d to %d", prev.Days, d.DaysRemaining))
+	case d.DaysRemaining > prev.Days:
+		changes = append(changes, fmt.Sprintf("days remaining rose from %d to %d", prev.Days, d.DaysRemaining))
+	default:
+		changes = append(changes, fmt.Sprintf("days remaining unchanged at %d", d.DaysRemaining))
+	}
+	if d.Status != prev.Status {
+		changes = append(changes, fmt.Sprintf("status changed from %s to %s", prev.Status, d.Status))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// withinDelta reports whether the domain is still in the status and
+// severity it was last notified in, and its days remaining dropped by less
+// than delta since then.
+func withinDelta(prev DomainState, d *Domain, delta int) bool {
+	if prev.NotifiedStatus != d.Status || prev.NotifiedSeverity != d.Severity {
+		return false
+	}
+	drop := prev.NotifiedDays - d.DaysRemaining
+	return drop >= 0 && drop < delta
+}
+
+// sameNames reports whether both lists hold the same names in any order.
+func sameNames(a []string, b []string) bool {
+	a = slices.Clone(a)
+	b = slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// diffNames returns the names in want that are not in got, and the names in
+// got that are not in want.
+func diffNames(want []string, got []string) ([]string, []string) {
+	missing := []string{}
+	for _, name := range want {
+		if !slices.Contains(got, name) {
+			missing = append(missing, name)
+		}
+	}
+	extra := []string{}
+	for _, name := range got {
+		if !slices.Contains(want, name) {
+			extra = append(extra, name)
+		}
+	}
+	return missing, extra
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// printStats writes run statistics as one key=value pair per line. Durations
+// are in seconds.
+func printStats(w io.Writer, domains []Domain, elapsed time.Duration) {
+	succeeded, failed := 0, 0
+	durations := []time.Duration{}
+	for _, domain := range domains {
+		if domain.Status == StatusError {
+			failed++
+		} else {
+			succeeded++
+		}
+		durations = append(durations, domain.Timings.Total)
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+	var avg time.Duration
+	if len(durations) > 0 {
+		avg = sum / time.Duration(len(durations))
+	}
+
+	fmt.Fprintf(w, "checked=%d\n", len(domains))
+	fmt.Fprintf(w, "succeeded=%d\n", succeeded)
+	fmt.Fprintf(w, "failed=%d\n", failed)
+	fmt.Fprintf(w, "total_seconds=%.3f\n", elapsed.Seconds())
+	fmt.Fprintf(w, "avg_seconds=%.3f\n", avg.Seconds())
+	fmt.Fprintf(w, "median_seconds=%.3f\n", percentile(durations, 50).Seconds())
+	fmt.Fprintf(w, "p95_seconds=%.3f\n", percentile(durations, 95).Seconds())
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// writeMinDays atomically writes the fewest days remaining across the
+// domains as a single line, for the simplest of readers. The file is left
+// as it was when no domain could be checked.
+func writeMinDays(path string, domains []Domain) error {
+	soonest, found := soonestExpiry(domains)
+	if !found {
+		return fmt.Errorf("no domain could be checked")
+	}
+	return writeFileAtomic(path, []byte(strconv.Itoa(soonest.DaysRemaining)+"\n"), 0o644)
+}
+
+// soonestExpiry returns the checked domain whose cert expires first.
+func soonestExpiry(domains []Domain) (Domain, bool) {
+	var soonest Domain
+	found := false
+	for _, d := range succeeded(domains) {
+		if !found || d.DaysRemaining < soonest.DaysRemaining || (d.DaysRemaining == soonest.DaysRemaining && d.Expires < soonest.Expires) {
+			soonest = d
+			found = true
+		}
+	}
+	return soonest, found
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const defaultStatuspageAPIURL = "https://api.statuspage.io/v1"
+
+type StatuspageConfig struct {
+	APIKey      string `yaml:"api_key,omitempty"`
+	PageID      string `yaml:"page_id,omitempty"`
+	ComponentID string `yaml:"component_id,omitempty"`
+	APIURL      string `yaml:"api_url,omitempty"`
+}
+
+// statuspageNotifier sets a Statuspage.io component to degraded while any of
+// its domains is notifiable, and back to operational once none are. It is
+// left as it is when none of its domains could be checked.
+type statuspageNotifier struct {
+	config StatuspageConfig
+	client *http.Client
+}
+
+func newStatuspageNotifier(config StatuspageConfig) *statuspageNotifier {
+	if config.APIURL == "" {
+		config.APIURL = defaultStatuspageAPIURL
+	}
+	return &statuspageNotifier{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (n *statuspageNotifier) Name() string {
+	return "statuspage"
+}
+
+func (n *statuspageNotifier) Notify(ctx context.Context, domains []Domain) error {
+	// Without any result the monitor cannot tell whether the certs are
+	// healthy, so it must not report them as operational
+	if len(succeeded(domains)) == 0 {
+		slog.Warn("no domain could be checked, leaving the statuspage component unchanged")
+		return nil
+	}
+	status := "operational"
+	for _, domain := range domains {
+		if domain.IsNotifiable() {
+			status = "degraded_performance"
+			break
+		}
+	}
+
+	body, err := json.Marshal(map[string]any{"component": map[string]string{"status": status}})
+	if err != nil {
+		return err
+	}
+	err = n.do(ctx, http.MethodPatch, body)
+	logReceipt(ctx, n.Name(), fmt.Sprintf("%s/%s", n.config.PageID, n.config.ComponentID), domainRefs(domains), err)
+	return err
+}
+
+// Check confirms the key can read the component.
+func (n *statuspageNotifier) Check(ctx context.Context) error {
+	return n.do(ctx, http.MethodGet, nil)
+}
+
+func (n *statuspageNotifier) do(ctx context.Context, method string, body []byte) error {
+	url := fmt.Sprintf("%s/pages/%s/components/%s", strings.TrimSuffix(n.config.APIURL, "/"), n.config.PageID, n.config.ComponentID)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "OAuth "+n.config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("statuspage returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// summaryFile fails where file descriptors are not inherited by number.
+func summaryFile(fd int) (*os.File, error) {
+	return nil, fmt.Errorf("-summary-fd is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// summaryFile opens the inherited fd the summary is written to, such as the
+// write end of a pipe created by a supervisor.
+func summaryFile(fd int) (*os.File, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); err != nil {
+		return nil, fmt.Errorf("-summary-fd %d is not an open file descriptor: %w", fd, err)
+	}
+	return os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd)), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// SummaryData is what the summary template is executed with: the domains of
+// the run and aggregates computed over them.
+type SummaryData struct {
+	// Domains are the checked domains, as in the json output.
+	Domains []Domain
+	// Checked is how many domains were checked, Expiring how many are
+	// within the threshold, Expired how many have expired and Problems how
+	// many have a flagged problem.
+	Checked  int
+	Expiring int
+	Expired  int
+	Problems int
+	// Soonest is the domain that expires first, nil when none were checked.
+	Soonest *Domain
+}
+
+func newSummaryData(domains []Domain) SummaryData {
+	data := SummaryData{Domains: domains, Checked: len(domains)}
+	for _, d := range domains {
+		if d.IsExpiringSoon {
+			data.Expiring++
+		}
+		if d.Status == StatusExpired {
+			data.Expired++
+		}
+		if len(d.Problems) > 0 {
+			data.Problems++
+		}
+	}
+	if soonest, found := soonestExpiry(domains); found {
+		data.Soonest = &soonest
+	}
+	return data
+}
+
+// renderSummary executes the summary template over the run's domains.
+func renderSummary(text string, domains []Domain) (string, error) {
+	tmpl, err := template.New("summary").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newSummaryData(domains)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
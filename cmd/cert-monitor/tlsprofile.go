@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// TLSProfile is a named set of handshake settings that domains share by
+// referencing it with tls_profile.
+type TLSProfile struct {
+	// MinVersion and MaxVersion limit the offered versions to 1.0, 1.1,
+	// 1.2 or 1.3.
+	MinVersion string `yaml:"min_version,omitempty"`
+	MaxVersion string `yaml:"max_version,omitempty"`
+	// CipherSuites are the suites offered up to TLS 1.2, by their standard
+	// names such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. TLS 1.3 suites
+	// cannot be chosen.
+	CipherSuites []string `yaml:"cipher_suites,omitempty"`
+	// ALPN are the application protocols offered, such as h2.
+	ALPN []string `yaml:"alpn,omitempty"`
+	// Renegotiate works like the domain setting of the same name.
+	Renegotiate bool `yaml:"renegotiate,omitempty"`
+}
+
+// apply sets the profile's versions, cipher suites and protocols on the
+// handshake config. Renegotiate is applied by the caller, as it changes more
+// than the handshake.
+func (p TLSProfile) apply(tlsConfig *tls.Config) error {
+	if p.MinVersion != "" {
+		version, ok := tlsVersion(p.MinVersion)
+		if !ok {
+			return fmt.Errorf("unsupported min_version %q, expected 1.0, 1.1, 1.2 or 1.3", p.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if p.MaxVersion != "" {
+		version, ok := tlsVersion(p.MaxVersion)
+		if !ok {
+			return fmt.Errorf("unsupported max_version %q, expected 1.0, 1.1, 1.2 or 1.3", p.MaxVersion)
+		}
+		tlsConfig.MaxVersion = version
+	}
+	for _, name := range p.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return fmt.Errorf("unknown cipher suite %s", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+	tlsConfig.NextProtos = p.ALPN
+	return nil
+}
+
+// problems returns what is wrong with the profile, for validate.
+func (p TLSProfile) problems() []string {
+	problems := []string{}
+	if err := p.apply(&tls.Config{}); err != nil {
+		problems = append(problems, err.Error())
+	}
+	minVersion, minOK := tlsVersion(p.MinVersion)
+	maxVersion, maxOK := tlsVersion(p.MaxVersion)
+	if minOK && maxOK && minVersion > maxVersion {
+		problems = append(problems, fmt.Sprintf("min_version %s is above max_version %s", p.MinVersion, p.MaxVersion))
+	}
+	return problems
+}
+
+func tlsVersion(name string) (uint16, bool) {
+	for _, v := range tlsVersions {
+		if v.name == name {
+			return v.version, true
+		}
+	}
+	return 0, false
+}
+
+// cipherSuiteID looks a suite up by name among the secure and insecure
+// suites Go implements.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if strings.EqualFold(suite.Name, name) {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
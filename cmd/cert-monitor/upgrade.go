@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const defaultUpgradeRequest = "OPTIONS * HTTP/1.1"
+
+// HTTPUpgradeConfig upgrades a plaintext HTTP connection to TLS, as in
+// RFC 2817, for services that only present their cert after the upgrade.
+// Request is the request line, and Headers are sent in addition to Host,
+// and to Upgrade and Connection unless overridden.
+type HTTPUpgradeConfig struct {
+	Request string            `yaml:"request,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+func (c HTTPUpgradeConfig) enabled() bool {
+	return c.Request != "" || len(c.Headers) > 0
+}
+
+// negotiateHTTPUpgrade returns a negotiator that sends the upgrade request
+// and waits for the server to switch protocols.
+func negotiateHTTPUpgrade(host string, upgrade HTTPUpgradeConfig) negotiator {
+	return func(conn net.Conn) error {
+		requestLine := upgrade.Request
+		if requestLine == "" {
+			requestLine = defaultUpgradeRequest
+		}
+		headers := map[string]string{
+			"Host":       host,
+			"Upgrade":    "TLS/1.2",
+			"Connection": "Upgrade",
+			"User-Agent": "cert-monitor/" + VERSION,
+		}
+		for k, v := range upgrade.Headers {
+			headers[http.CanonicalHeaderKey(k)] = v
+		}
+		names := []string{}
+		for k := range headers {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var req strings.Builder
+		req.WriteString(requestLine + "\r\n")
+		for _, k := range names {
+			fmt.Fprintf(&req, "%s: %s\r\n", k, headers[k])
+		}
+		req.WriteString("\r\n")
+		if _, err := conn.Write([]byte(req.String())); err != nil {
+			return err
+		}
+
+		// Read byte by byte so nothing after the response is buffered away
+		// from the TLS handshake.
+		resp, err := http.ReadResponse(bufio.NewReaderSize(byteReader{conn}, 16), nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			return fmt.Errorf("upgrade refused: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// byteReader reads at most one byte at a time.
+type byteReader struct {
+	conn net.Conn
+}
+
+func (r byteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.conn.Read(p)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// validate checks the whole config for values that cannot work, returning
+// every problem found, each naming the field it is about.
+func (c Config) validate() []string {
+	problems := []string{}
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	notNegative := func(field string, value int) {
+		if value < 0 {
+			add("%s must not be negative, got %d", field, value)
+		}
+	}
+
+	notNegative("threshold", c.Threshold)
+	notNegative("min_lifetime", c.MinLifetime)
+	notNegative("max_lifetime", c.MaxLifetime)
+	notNegative("notify_delta", c.NotifyDelta)
+	notNegative("check_concurrency", c.CheckConcurrency)
+	notNegative("notify_concurrency", c.NotifyConcurrency)
+	notNegative("run_retries", c.RunRetries)
+	notNegative("wildcard_min_depth", c.WildcardMinDepth)
+	notNegative("severity.critical", c.Severity.Critical)
+	notNegative("severity.warning", c.Severity.Warning)
+	notNegative("non_working_days.escalation", c.NonWorkingDays.Escalation)
+	for _, issuer := range sortedKeys(c.IssuerThresholds) {
+		notNegative(fmt.Sprintf("issuer_thresholds[%q]", issuer), c.IssuerThresholds[issuer])
+	}
+	notNegative("preflight.sample", c.Preflight.Sample)
+	if c.Interval < 0 {
+		add("interval must not be negative, got %s", c.Interval)
+	}
+	if c.MinLifetime > 0 && c.MaxLifetime > 0 && c.MinLifetime > c.MaxLifetime {
+		add("min_lifetime (%d) must not be above max_lifetime (%d)", c.MinLifetime, c.MaxLifetime)
+	}
+	if !c.Freeze.Start.IsZero() && c.Freeze.End.IsZero() {
+		add("freeze.start requires freeze.end")
+	}
+	if !c.Freeze.End.IsZero() && c.Freeze.End.Before(c.Freeze.Start) {
+		add("freeze.end %s must not be before freeze.start %s", c.Freeze.End.Format("2006-01-02"), c.Freeze.Start.Format("2006-01-02"))
+	}
+	if c.Severity.Critical > 0 && c.Severity.Warning > 0 && c.Severity.Critical > c.Severity.Warning {
+		add("severity.critical (%d) must not be above severity.warning (%d)", c.Severity.Critical, c.Severity.Warning)
+	}
+
+	if c.SMTP.Server != "" && len(c.SMTP.To) == 0 {
+		add("smtp.to must list at least one recipient when smtp.server is set")
+	}
+	if c.SMTP.Port < 0 || c.SMTP.Port > 65535 {
+		add("smtp.port must be between 1 and 65535, got %d", c.SMTP.Port)
+	}
+	for i, action := range c.Slack.Actions {
+		if action.Text == "" || action.URL == "" {
+			add("slack.actions[%d] needs a text and a url", i)
+		}
+	}
+	if c.Preflight.Canary != "" {
+		if _, _, err := net.SplitHostPort(c.Preflight.Canary); err != nil {
+			add("preflight.canary %q must be a host:port", c.Preflight.Canary)
+		}
+	}
+	for i, allowed := range c.CryptoPolicy.Allow {
+		if !slices.Contains(keyAlgorithms, allowed.Algorithm) {
+			add("crypto_policy.allow[%d].algorithm %q is unknown, expected one of %s", i, allowed.Algorithm, strings.Join(keyAlgorithms, ", "))
+		}
+		notNegative(fmt.Sprintf("crypto_policy.allow[%d].min_bits", i), allowed.MinBits)
+	}
+	for _, name := range sortedKeys(c.TLSProfiles) {
+		for _, problem := range c.TLSProfiles[name].problems() {
+			add("tls_profiles[%q]: %s", name, problem)
+		}
+	}
+	if c.Webhook.ChangesOnly && !c.Webhook.Batch {
+		add("webhook.changes_only requires webhook.batch")
+	}
+	if c.Exec.Timeout < 0 {
+		add("exec.timeout must not be negative, got %s", c.Exec.Timeout)
+	}
+	if c.Exec.Command == "" && len(c.Exec.Args) > 0 {
+		add("exec.args requires exec.command")
+	}
+	if c.Kafka.Topic != "" && len(c.Kafka.Brokers) == 0 {
+		add("kafka.brokers must list at least one broker when kafka.topic is set")
+	}
+
+	if c.StateFile == "" {
+		if c.NotifyDelta > 0 {
+			add("notify_delta requires state_file")
+		}
+		if c.NotifyTrend {
+			add("notify_trend requires state_file")
+		}
+		if len(c.ResolvedNotifiers) > 0 {
+			add("resolved_notifiers requires state_file")
+		}
+	}
+	if c.DedupKey != "" {
+		if _, err := template.New("dedup_key").Parse(c.DedupKey); err != nil {
+			add("dedup_key is not a valid template: %s", err.Error())
+		}
+		if c.NotifyDelta == 0 {
+			add("dedup_key requires notify_delta")
+		}
+	}
+	checkNotifierNames := func(field string, names []string) {
+		for i, name := range names {
+			if !slices.Contains(notifierNames, name) {
+				add("%s[%d] %q is unknown, expected one of %s", field, i, name, strings.Join(notifierNames, ", "))
+			}
+		}
+	}
+	checkNotifierNames("default_notifiers", c.DefaultNotifiers)
+	checkNotifierNames("resolved_notifiers", c.ResolvedNotifiers)
+	checkEKUNames := func(field string, names []string) {
+		for i, name := range names {
+			if _, ok := extKeyUsages[name]; !ok {
+				add("%s[%d] %q is unknown, expected one of %s", field, i, name, strings.Join(sortedKeys(extKeyUsages), ", "))
+			}
+		}
+	}
+	checkEKUNames("expected_eku", c.ExpectedEKU)
+	if c.CheckWindow.enabled() {
+		if _, err := c.CheckWindow.untilOpen(time.Now()); err != nil {
+			add("%s", err.Error())
+		}
+	}
+
+	for i, dc := range c.Domains {
+		field := fmt.Sprintf("domains[%d]", i)
+		switch {
+		case dc.Name == "" && dc.File == "" && len(dc.ProbeNames) == 0 && dc.SNIMap == "":
+			add("%s needs a name, a file, probe_names or an sni_map", field)
+		case dc.File != "" && (dc.Name != "" || dc.Address != ""):
+			add("%s.file cannot be combined with name or address", field)
+		case dc.Name != "" && len(dc.ProbeNames) > 0:
+			add("%s.name cannot be combined with probe_names, which replace it", field)
+		case dc.SNIMap != "" && (dc.Name != "" || dc.File != "" || len(dc.ProbeNames) > 0):
+			add("%s.sni_map cannot be combined with name, file or probe_names, which it replaces", field)
+		}
+		if dc.Threshold != nil {
+			notNegative(field+".threshold", *dc.Threshold)
+		}
+		if dc.Port < 0 || dc.Port > 65535 {
+			add("%s.port must be between 1 and 65535, got %d", field, dc.Port)
+		}
+		if dc.StartTLS != "" && startTLSNegotiators[dc.StartTLS] == nil {
+			add("%s.starttls %q is unknown, expected one of %s", field, dc.StartTLS, strings.Join(sortedKeys(startTLSNegotiators), ", "))
+		}
+		if dc.StartTLS != "" && dc.HTTPUpgrade.enabled() {
+			add("%s.starttls cannot be combined with http_upgrade", field)
+		}
+		if dc.RejectBelow != "" && !slices.Contains([]string{"1.1", "1.2", "1.3"}, dc.RejectBelow) {
+			add("%s.reject_below %q is unknown, expected 1.1, 1.2 or 1.3", field, dc.RejectBelow)
+		}
+		if dc.SPKIPin != "" {
+			if pin, err := base64.StdEncoding.DecodeString(dc.SPKIPin); err != nil || len(pin) != 32 {
+				add("%s.spki_pin must be the base64 SHA-256 of a public key", field)
+			}
+		}
+		if fp := normalizeFingerprint(dc.ExpectedFingerprint); fp != "" {
+			if raw, err := hex.DecodeString(fp); err != nil || len(raw) != 32 {
+				add("%s.expected_fingerprint must be the hex SHA-256 of a cert", field)
+			}
+		}
+		if _, ok := c.TLSProfiles[dc.TLSProfile]; dc.TLSProfile != "" && !ok {
+			add("%s.tls_profile %q is not in tls_profiles", field, dc.TLSProfile)
+		}
+		checkNotifierNames(field+".notifiers", dc.Notifiers)
+		checkEKUNames(field+".expected_eku", dc.ExpectedEKU)
+	}
+	return problems
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
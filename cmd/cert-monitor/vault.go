@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultVaultField = "certificate"
+
+// VaultConfig reads canonical certs from HashiCorp Vault. Address and Token
+// default to VAULT_ADDR and VAULT_TOKEN. Without a token, RoleID and
+// SecretID log in with AppRole.
+type VaultConfig struct {
+	Address  string `yaml:"address,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+	RoleID   string `yaml:"role_id,omitempty"`
+	SecretID string `yaml:"secret_id,omitempty"`
+}
+
+// VaultCertConfig is the secret holding a domain's canonical cert, as PEM in
+// Field (default certificate). Both KV version 1 and 2 paths work, KV 2
+// paths include data/, e.g. secret/data/certs/example.com.
+type VaultCertConfig struct {
+	Path  string `yaml:"path,omitempty"`
+	Field string `yaml:"field,omitempty"`
+}
+
+type vaultClient struct {
+	config VaultConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+var (
+	vaultOnce sync.Once
+	vault     *vaultClient
+)
+
+// vaultFor returns the process wide Vault client, so an AppRole login is
+// shared by every domain.
+func vaultFor(config VaultConfig) *vaultClient {
+	vaultOnce.Do(func() {
+		if config.Address == "" {
+			config.Address = os.Getenv("VAULT_ADDR")
+		}
+		if config.Token == "" {
+			config.Token = os.Getenv("VAULT_TOKEN")
+		}
+		vault = &vaultClient{config: config, client: &http.Client{Timeout: 30 * time.Second}, token: config.Token}
+	})
+	return vault
+}
+
+// login returns the token to use, logging in with AppRole if needed.
+func (v *vaultClient) login(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.token != "" {
+		return v.token, nil
+	}
+	if v.config.RoleID == "" {
+		return "", fmt.Errorf("no vault token or approle role_id configured")
+	}
+
+	body, err := json.Marshal(map[string]string{"role_id": v.config.RoleID, "secret_id": v.config.SecretID})
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := v.do(ctx, http.MethodPost, "auth/approle/login", "", body, &out); err != nil {
+		return "", fmt.Errorf("approle login failed: %w", err)
+	}
+	v.token = out.Auth.ClientToken
+	return v.token, nil
+}
+
+// readCert reads the PEM cert stored at the secret's path.
+func (v *vaultClient) readCert(ctx context.Context, secret VaultCertConfig) ([]byte, error) {
+	if v.config.Address == "" {
+		return nil, fmt.Errorf("no vault address configured")
+	}
+	token, err := v.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, secret.Path, token, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", secret.Path, err)
+	}
+	data := out.Data
+	// KV version 2 nests the secret's fields one level deeper
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+
+	field := secret.Field
+	if field == "" {
+		field = defaultVaultField
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s has no %s field", secret.Path, field)
+	}
+	return []byte(value), nil
+}
+
+func (v *vaultClient) do(ctx context.Context, method string, path string, token string, body []byte, out any) error {
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(v.config.Address, "/"), strings.TrimPrefix(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&vaultErr)
+		if len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(vaultErr.Errors, ", "))
+		}
+		return fmt.Errorf("vault returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkVault compares the served leaf against the cert stored in Vault,
+// returning a problem description when they differ.
+func checkVault(ctx context.Context, config VaultConfig, secret VaultCertConfig, served string) (string, error) {
+	data, err := vaultFor(config).readCert(ctx, secret)
+	if err != nil {
+		return "", err
+	}
+	certs, err := parsePEM(data, secret.Path)
+	if err != nil {
+		return "", err
+	}
+	if stored := fingerprint(certs[0]); stored != served {
+		return fmt.Sprintf("served cert %s does not match the cert in vault at %s (%s)", served, secret.Path, stored), nil
+	}
+	return "", nil
+}
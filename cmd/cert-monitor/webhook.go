@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+type WebhookConfig struct {
+	URL string `yaml:"url,omitempty"`
+	// Headers are added to every request, such as an Authorization token.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Batch sends a single request at the end of each run holding every
+	// domain and the run's totals, instead of one per notifiable domain.
+	Batch bool `yaml:"batch,omitempty"`
+	// ChangesOnly limits a batch to the domains that would be notified
+	// about or were resolved, and skips the request when there are none.
+	ChangesOnly bool          `yaml:"changes_only,omitempty"`
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+}
+
+// webhookEvent is the payload posted for one domain. Header and Footer are
+// the notification_header and notification_footer, for receivers that show
+// them.
+type webhookEvent struct {
+	Event  string `json:"event"`
+	Domain Domain `json:"domain"`
+	Header string `json:"header,omitempty"`
+	Footer string `json:"footer,omitempty"`
+}
+
+// webhookBatch is the payload posted once per run in batch mode.
+type webhookBatch struct {
+	Run     webhookRun `json:"run"`
+	Domains []Domain   `json:"domains"`
+	Header  string     `json:"header,omitempty"`
+	Footer  string     `json:"footer,omitempty"`
+}
+
+type webhookRun struct {
+	Source    string `json:"source"`
+	Version   string `json:"version"`
+	Generated string `json:"generated"`
+	Checked   int    `json:"checked"`
+	Expiring  int    `json:"expiring"`
+	Expired   int    `json:"expired"`
+	Problems  int    `json:"problems"`
+}
+
+// webhookNotifier posts the results as json to a URL, one request per
+// notifiable domain or one per run.
+type webhookNotifier struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+func newWebhookNotifier(config WebhookConfig) *webhookNotifier {
+	return &webhookNotifier{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (n *webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, domains []Domain) error {
+	if n.config.Batch {
+		return n.notifyBatch(ctx, domains)
+	}
+
+	config := ctx.Value(configKey{}).(*Config)
+	var mu sync.Mutex
+	errs := []string{}
+	parallel(config.notifyConcurrency(), len(domains), func(i int) {
+		domain := domains[i]
+		event := webhookEventFor(domain, config.ResolvedNotifiers)
+		if event == "" {
+			return
+		}
+		err := n.post(ctx, webhookEvent{Event: event, Domain: domain, Header: config.NotificationHeader, Footer: config.NotificationFooter})
+		logReceipt(ctx, n.Name(), webhookHost(n.config.URL), []string{domain.NameRef}, err)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Sprintf("%s: %s", domain.NameRef, err.Error()))
+			mu.Unlock()
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// webhookEventFor names what a domain is notified about, empty when it is
+// not.
+func webhookEventFor(domain Domain, resolvedNotifiers []string) string {
+	switch {
+	case domain.Quiet:
+		return ""
+	case domain.Resolved && slices.Contains(resolvedNotifiers, "webhook"):
+		return "resolved"
+	case domain.IsExpiringSoon:
+		return "expiring"
+	case domain.IsNotifiable():
+		return "problem"
+	}
+	return ""
+}
+
+func (n *webhookNotifier) notifyBatch(ctx context.Context, domains []Domain) error {
+	config := ctx.Value(configKey{}).(*Config)
+	if n.config.ChangesOnly {
+		changed := []Domain{}
+		for _, domain := range domains {
+			if webhookEventFor(domain, config.ResolvedNotifiers) != "" {
+				changed = append(changed, domain)
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		domains = changed
+	}
+
+	data := newSummaryData(domains)
+	batch := webhookBatch{
+		Run: webhookRun{
+			Source:    config.source(),
+			Version:   VERSION,
+			Generated: time.Now().UTC().Format(time.RFC3339),
+			Checked:   data.Checked,
+			Expiring:  data.Expiring,
+			Expired:   data.Expired,
+			Problems:  data.Problems,
+		},
+		Domains: domains,
+		Header:  config.NotificationHeader,
+		Footer:  config.NotificationFooter,
+	}
+	err := n.post(ctx, batch)
+	logReceipt(ctx, n.Name(), webhookHost(n.config.URL), domainRefs(domains), err)
+	return err
+}
+
+// Check sends a HEAD request, confirming the URL is reachable without
+// posting anything. Any answer short of a server error counts.
+func (n *webhookNotifier) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, n.config.URL, nil)
+	if err != nil {
+		return err
+	}
+	n.setHeaders(req)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *webhookNotifier) post(ctx context.Context, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	throttleFor(n.Name()).wait(n.Name(), n.config.MinInterval)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	n.setHeaders(req)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (n *webhookNotifier) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", "cert-monitor/"+VERSION)
+	for k, v := range n.config.Headers {
+		req.Header.Set(k, v)
+	}
+}
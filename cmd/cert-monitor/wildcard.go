@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// broadWildcards returns a problem for every wildcard DNS name that covers
+// more than minDepth allows. The depth of *.svc.example.com is 3, the number
+// of labels below the wildcard, so a minDepth of 2 rejects *.com but allows
+// *.example.com. Wildcards outside the leftmost label, such as *.*.com or
+// www.*.example.com, are always flagged, as is a bare * matching any name.
+func broadWildcards(names []string, minDepth int) []string {
+	problems := []string{}
+	for _, name := range names {
+		if !strings.Contains(name, "*") {
+			continue
+		}
+		if name == "*" {
+			problems = append(problems, "wildcard * matches any name")
+			continue
+		}
+		base, ok := strings.CutPrefix(name, "*.")
+		if !ok || strings.Contains(base, "*") {
+			problems = append(problems, fmt.Sprintf("wildcard %s is not limited to the leftmost label", name))
+			continue
+		}
+		if len(strings.Split(base, ".")) < minDepth {
+			problems = append(problems, fmt.Sprintf("wildcard %s is broader than wildcard_min_depth %d allows", name, minDepth))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CheckWindowConfig limits daemon checks to certain hours of certain days.
+// Outside the window the daemon waits for it to open again.
+type CheckWindowConfig struct {
+	// Days are day names such as monday, all days when empty.
+	Days []string `yaml:"days,omitempty"`
+	// Start and End are times of day as 15:04, the whole day when empty.
+	Start string `yaml:"start,omitempty"`
+	End   string `yaml:"end,omitempty"`
+	// Timezone is an IANA name such as Europe/Berlin, the local time zone
+	// when empty.
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+func (c CheckWindowConfig) enabled() bool {
+	return len(c.Days) > 0 || c.Start != "" || c.End != ""
+}
+
+// untilOpen returns how long it is from now until the window opens, or zero
+// when now is inside it.
+func (c CheckWindowConfig) untilOpen(now time.Time) (time.Duration, error) {
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(c.Timezone)
+		if err != nil {
+			return 0, fmt.Errorf("invalid check_window timezone: %w", err)
+		}
+	}
+	start, err := parseTimeOfDay(c.Start, 0)
+	if err != nil {
+		return 0, err
+	}
+	end, err := parseTimeOfDay(c.End, 24*time.Hour)
+	if err != nil {
+		return 0, err
+	}
+	if end <= start {
+		return 0, fmt.Errorf("check_window end %s must be after start %s", c.End, c.Start)
+	}
+	for _, day := range c.Days {
+		if !isWeekday(day) {
+			return 0, fmt.Errorf("invalid check_window day: %s", day)
+		}
+	}
+
+	now = now.In(loc)
+	for i := 0; i <= 7; i++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()+i, 0, 0, 0, 0, loc)
+		if !c.includesDay(day.Weekday()) {
+			continue
+		}
+		open := day.Add(start)
+		closed := day.Add(end)
+		if now.Before(open) {
+			return open.Sub(now), nil
+		}
+		if now.Before(closed) {
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("check_window never opens")
+}
+
+func (c CheckWindowConfig) includesDay(weekday time.Weekday) bool {
+	if len(c.Days) == 0 {
+		return true
+	}
+	for _, day := range c.Days {
+		if strings.EqualFold(day, weekday.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeOfDay parses 15:04 as the time since midnight, or returns
+// fallback for an empty value.
+func parseTimeOfDay(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid check_window time %q, expected 15:04", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func isWeekday(name string) bool {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return true
+		}
+	}
+	return false
+}
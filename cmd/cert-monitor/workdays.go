@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// NonWorkingDaysConfig raises the threshold for certs that expire on a day
+// nobody is around to renew them, so they are flagged while there is still
+// a working day left to handle them.
+type NonWorkingDaysConfig struct {
+	// Weekdays are day names such as saturday and sunday, Dates are holidays
+	// as 2006-01-02. Both are judged in the local time zone.
+	Weekdays []string `yaml:"weekdays,omitempty"`
+	Dates    []string `yaml:"dates,omitempty"`
+	// Escalation is how many days are added to the threshold.
+	Escalation int `yaml:"escalation,omitempty"`
+}
+
+// includes reports whether t falls on a configured non-working day.
+func (c NonWorkingDaysConfig) includes(t time.Time) bool {
+	t = t.Local()
+	for _, weekday := range c.Weekdays {
+		if strings.EqualFold(weekday, t.Weekday().String()) {
+			return true
+		}
+	}
+	return slices.Contains(c.Dates, t.Format("2006-01-02"))
+}